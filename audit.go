@@ -2,15 +2,18 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"sort"
 	"strings"
 
 	"github.com/google/go-github/github"
 )
 
-const auditHelp = `Audit collaborators, branches, hooks, deploy keys etc.`
+const auditHelp = `Audit collaborators, branches, rulesets, hooks, deploy keys etc.`
 
 func (cmd *auditCommand) Name() string      { return "audit" }
 func (cmd *auditCommand) Args() string      { return "[OPTIONS]" }
@@ -18,16 +21,84 @@ func (cmd *auditCommand) ShortHelp() string { return auditHelp }
 func (cmd *auditCommand) LongHelp() string  { return auditHelp }
 func (cmd *auditCommand) Hidden() bool      { return false }
 
-func (cmd *auditCommand) Register(fs *flag.FlagSet) {}
+func (cmd *auditCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.keysJSON, "keys-json", "", "write the inventory of all deploy keys by fingerprint as JSON to the file")
+}
+
+type auditCommand struct {
+	keysJSON string
+
+	// keys holds the repositories using every deploy key by fingerprint.
+	keys map[string][]keyUse
+}
 
-type auditCommand struct{}
+// keyUse is a repository using a deploy key.
+type keyUse struct {
+	Repository string `json:"repository"`
+	Title      string `json:"title"`
+	ReadOnly   bool   `json:"read_only"`
+}
+
+// keyInventory is a deploy key and the repositories using it.
+type keyInventory struct {
+	Fingerprint  string   `json:"fingerprint"`
+	Shared       bool     `json:"shared"`
+	Repositories []keyUse `json:"repositories"`
+}
 
 func (cmd *auditCommand) Run(ctx context.Context, args []string) error {
-	return runCommand(ctx, handleAudit)
+	cmd.keys = map[string][]keyUse{}
+
+	if err := runCommand(ctx, cmd.handleAudit); err != nil {
+		return err
+	}
+
+	inventory := []keyInventory{}
+	for fp, uses := range cmd.keys {
+		inventory = append(inventory, keyInventory{
+			Fingerprint:  fp,
+			Shared:       len(uses) > 1,
+			Repositories: uses,
+		})
+	}
+	sort.Slice(inventory, func(i, j int) bool {
+		if len(inventory[i].Repositories) != len(inventory[j].Repositories) {
+			return len(inventory[i].Repositories) > len(inventory[j].Repositories)
+		}
+		return inventory[i].Fingerprint < inventory[j].Fingerprint
+	})
+
+	// Report the deploy keys that are used by more than one repository.
+	shared := []string{}
+	for _, k := range inventory {
+		if !k.Shared {
+			continue
+		}
+		uses := []string{}
+		for _, u := range k.Repositories {
+			uses = append(uses, fmt.Sprintf("\t\t%s (%s) - ro:%t", u.Repository, u.Title, u.ReadOnly))
+		}
+		shared = append(shared, fmt.Sprintf("\t%s (%d repos):\n%s", k.Fingerprint, len(k.Repositories), strings.Join(uses, "\n")))
+	}
+	if len(shared) > 0 {
+		fmt.Printf("Shared Deploy Keys (%d):\n%s\n--\n\n", len(shared), strings.Join(shared, "\n"))
+	}
+
+	if len(cmd.keysJSON) > 0 {
+		b, err := json.MarshalIndent(inventory, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(cmd.keysJSON, append(b, '\n'), 0644); err != nil {
+			return fmt.Errorf("writing deploy key inventory to %s failed: %v", cmd.keysJSON, err)
+		}
+	}
+
+	return nil
 }
 
 // handleAudit will return nil error if the user does not have access to something.
-func handleAudit(ctx context.Context, client *github.Client, repo *github.Repository) error {
+func (cmd *auditCommand) handleAudit(ctx context.Context, client *github.Client, repo *github.Repository) error {
 	opt := &github.ListOptions{
 		PerPage: 100,
 	}
@@ -56,8 +127,8 @@ func handleAudit(ctx context.Context, client *github.Client, repo *github.Reposi
 		return err
 	}
 
-	keys, resp, err := client.Repositories.ListKeys(ctx, repo.GetOwner().GetLogin(), repo.GetName(), opt)
-	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden || err != nil {
+	keys, resp, err := listDeployKeys(ctx, client, repo)
+	if resp == nil || resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden || err != nil {
 		if _, ok := err.(*github.RateLimitError); ok {
 			return err
 		}
@@ -80,27 +151,79 @@ func handleAudit(ctx context.Context, client *github.Client, repo *github.Reposi
 		return err
 	}
 
-	branches, _, err := client.Repositories.ListBranches(ctx, repo.GetOwner().GetLogin(), repo.GetName(), opt)
+	branches, _, err := listBranches(ctx, client, repo)
 	if err != nil {
 		return err
 	}
+
+	// The rulesets API is not available everywhere, so ignore any errors and
+	// just report the classic protections.
+	rulesets, _, err := listRulesets(ctx, client, repo, true)
+	if err != nil {
+		if _, ok := err.(*github.RateLimitError); ok {
+			return err
+		}
+		rulesets = nil
+	}
+	rulesetNames := map[int64]string{}
+	for _, rs := range rulesets {
+		rulesetNames[rs.ID] = rs.Name
+	}
+
+	// The protected tags are the patterns of the tag rulesets.
+	protectedTags, err := listProtectedTags(ctx, client, repo, rulesets)
+	if err != nil {
+		if _, ok := err.(*github.RateLimitError); ok {
+			return err
+		}
+		protectedTags = nil
+	}
+
 	protectedBranches := []string{}
 	unprotectedBranches := []string{}
+	branchRulesets := []string{}
 	for _, branch := range branches {
 		// we must get the individual branch for the branch protection to work
 		b, _, err := client.Repositories.GetBranch(ctx, repo.GetOwner().GetLogin(), repo.GetName(), branch.GetName())
 		if err != nil {
 			return err
 		}
-		if b.GetProtected() {
+
+		// get the rulesets that target the branch
+		names := []string{}
+		if len(rulesets) > 0 {
+			// Ignore the errors like for the rulesets above.
+			rules, _, err := listBranchRules(ctx, client, repo, b.GetName())
+			if err != nil {
+				if _, ok := err.(*github.RateLimitError); ok {
+					return err
+				}
+				rules = nil
+			}
+			for _, r := range rules {
+				name, ok := rulesetNames[r.RulesetID]
+				if !ok {
+					name = fmt.Sprintf("%d", r.RulesetID)
+				}
+				if !in(names, name) {
+					names = append(names, name)
+				}
+			}
+		}
+
+		switch {
+		case b.GetProtected():
 			protectedBranches = append(protectedBranches, b.GetName())
-		} else {
+		case len(names) < 1:
 			unprotectedBranches = append(unprotectedBranches, b.GetName())
 		}
+		if len(names) > 0 {
+			branchRulesets = append(branchRulesets, fmt.Sprintf("\t\t%s: %s", b.GetName(), strings.Join(names, ", ")))
+		}
 	}
 
 	// only print whole status if we have more that one collaborator
-	if len(collabs) <= 1 && len(keys) < 1 && len(hooks) < 1 && len(protectedBranches) < 1 && len(unprotectedBranches) < 1 {
+	if len(collabs) <= 1 && len(keys) < 1 && len(hooks) < 1 && len(protectedBranches) < 1 && len(unprotectedBranches) < 1 && len(rulesets) < 1 && len(protectedTags) < 1 {
 		return nil
 	}
 
@@ -145,7 +268,17 @@ func handleAudit(ctx context.Context, client *github.Client, repo *github.Reposi
 	if len(keys) > 0 {
 		kstr := []string{}
 		for _, k := range keys {
-			kstr = append(kstr, fmt.Sprintf("\t\t%s - ro:%t (%s)", k.GetTitle(), k.GetReadOnly(), k.GetURL()))
+			fp, err := fingerprint(k.Key)
+			if err != nil {
+				fp = "unknown fingerprint"
+			} else {
+				cmd.keys[fp] = append(cmd.keys[fp], keyUse{
+					Repository: repo.GetFullName(),
+					Title:      k.Title,
+					ReadOnly:   k.ReadOnly,
+				})
+			}
+			kstr = append(kstr, fmt.Sprintf("\t\t%s - ro:%t %s (%s)", k.Title, k.ReadOnly, fp, k.URL))
 		}
 		output += fmt.Sprintf("\tKeys (%d):\n%s\n", len(kstr), strings.Join(kstr, "\n"))
 	}
@@ -166,6 +299,22 @@ func handleAudit(ctx context.Context, client *github.Client, repo *github.Reposi
 		output += fmt.Sprintf("\tUnprotected Branches (%d): %s\n", len(unprotectedBranches), strings.Join(unprotectedBranches, ", "))
 	}
 
+	if len(protectedTags) > 0 {
+		output += fmt.Sprintf("\tProtected Tags (%d): %s\n", len(protectedTags), strings.Join(protectedTags, ", "))
+	}
+
+	if len(rulesets) > 0 {
+		rstr := []string{}
+		for _, rs := range rulesets {
+			rstr = append(rstr, fmt.Sprintf("\t\t%s - target:%s enforcement:%s (%s)", rs.Name, rs.Target, rs.Enforcement, rs.Source))
+		}
+		output += fmt.Sprintf("\tRulesets (%d):\n%s\n", len(rstr), strings.Join(rstr, "\n"))
+	}
+
+	if len(branchRulesets) > 0 {
+		output += fmt.Sprintf("\tBranch Rulesets (%d):\n%s\n", len(branchRulesets), strings.Join(branchRulesets, "\n"))
+	}
+
 	repo, _, err = client.Repositories.Get(ctx, repo.GetOwner().GetLogin(), repo.GetName())
 	if err != nil {
 		return err
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const hooksHelp = `Add, update, remove webhooks, rotate their secrets and report their health.`
+
+const hooksLongHelp = `Add, update, remove webhooks, rotate their secrets and report their health.
+
+Actions:
+
+  ensure                make sure a webhook for --hook-url exists with the
+                        events, content type and secret, updating it if it
+                        differs
+  remove                delete the webhooks whose URL matches the --hook-url
+                        pattern, '*' matches any characters
+  rotate                set the secret of the webhooks whose URL matches the
+                        --hook-url pattern
+  status                report the webhooks that are failing, disabled,
+                        pointed at unreachable hosts or skip SSL verification,
+                        based on their last response and recent deliveries,
+                        --hook-url optionally filters the webhooks, failed
+                        deliveries are redelivered with --redeliver
+
+The secret is read from --secret-file or the environment variable named by
+--secret-env and is never printed.`
+
+func (cmd *hooksCommand) Name() string      { return "hooks" }
+func (cmd *hooksCommand) Args() string      { return "[OPTIONS] ACTION" }
+func (cmd *hooksCommand) ShortHelp() string { return hooksHelp }
+func (cmd *hooksCommand) LongHelp() string  { return hooksLongHelp }
+func (cmd *hooksCommand) Hidden() bool      { return false }
+
+func (cmd *hooksCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.url, "hook-url", "", "URL of the webhook, or the pattern of URLs to remove or rotate")
+	fs.Var(&cmd.events, "events", "events that trigger the webhook, can be passed multiple times (defaults to push)")
+	fs.StringVar(&cmd.contentType, "content-type", "json", "media type used to serialize the payloads (json or form)")
+	fs.BoolVar(&cmd.insecureSSL, "insecure-ssl", false, "Do not verify the SSL certificate of the URL when delivering payloads")
+	fs.Var(&cmd.active, "active", "Deliver payloads when the webhook is triggered (defaults to true)")
+	fs.StringVar(&cmd.secretFile, "secret-file", "", "file containing the webhook secret")
+	fs.StringVar(&cmd.secretEnv, "secret-env", "", "environment variable containing the webhook secret")
+	fs.IntVar(&cmd.deliveries, "deliveries", 10, "number of recent deliveries to check for the status")
+	fs.BoolVar(&cmd.redeliver, "redeliver", false, "Redeliver the recent failed deliveries when reporting the status")
+}
+
+type hooksCommand struct {
+	url         string
+	events      stringSlice
+	contentType string
+	insecureSSL bool
+	active      optionalBool
+	secretFile  string
+	secretEnv   string
+	deliveries  int
+	redeliver   bool
+
+	action  string
+	secret  string
+	pattern *regexp.Regexp
+}
+
+func (cmd *hooksCommand) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("must pass an action: ensure, remove, rotate or status")
+	}
+	cmd.action = args[0]
+
+	if len(cmd.url) < 1 && cmd.action != "status" {
+		return fmt.Errorf("must pass the webhook URL with --hook-url to %s", cmd.action)
+	}
+
+	var err error
+	cmd.secret, err = readSecret(cmd.secretFile, cmd.secretEnv)
+	if err != nil {
+		return err
+	}
+
+	switch cmd.action {
+	case "ensure":
+		if cmd.contentType != "json" && cmd.contentType != "form" {
+			return errors.New("content-type must be one of json or form")
+		}
+		if len(cmd.events) < 1 {
+			cmd.events = stringSlice{"push"}
+		}
+		if cmd.active.value == nil {
+			cmd.active.value = github.Bool(true)
+		}
+	case "remove":
+	case "rotate":
+		if len(cmd.secret) < 1 {
+			return errors.New("must pass the new secret with --secret-file or --secret-env to rotate")
+		}
+	case "status":
+		if cmd.deliveries < 1 || cmd.deliveries > 100 {
+			return errors.New("deliveries must be between 1 and 100")
+		}
+		if len(cmd.url) < 1 {
+			cmd.url = "*"
+		}
+	default:
+		return fmt.Errorf("unknown action %q, must be one of ensure, remove, rotate or status", cmd.action)
+	}
+
+	cmd.pattern = globRegexp(cmd.url)
+
+	return runCommand(ctx, cmd.handleRepoHooks)
+}
+
+// handleRepoHooks will return nil error if the user does not have access to something.
+func (cmd *hooksCommand) handleRepoHooks(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	hooks, resp, err := listHooks(ctx, client, repo)
+	if resp == nil || resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden || err != nil {
+		if _, ok := err.(*github.RateLimitError); ok {
+			return err
+		}
+
+		return nil
+	}
+
+	switch cmd.action {
+	case "ensure":
+		return cmd.ensureHook(ctx, client, repo, hooks)
+	case "remove":
+		for _, h := range hooks {
+			if !cmd.pattern.MatchString(hookURL(h)) {
+				continue
+			}
+
+			if dryrun {
+				fmt.Printf("[UPDATE] %s webhook %s will be deleted\n", repo.GetFullName(), hookURL(h))
+				continue
+			}
+
+			if _, err := client.Repositories.DeleteHook(ctx, repo.GetOwner().GetLogin(), repo.GetName(), h.GetID()); err != nil {
+				return err
+			}
+			fmt.Printf("[OK] %s webhook %s is deleted\n", repo.GetFullName(), hookURL(h))
+		}
+	case "rotate":
+		for _, h := range hooks {
+			if !cmd.pattern.MatchString(hookURL(h)) {
+				continue
+			}
+
+			if dryrun {
+				fmt.Printf("[UPDATE] %s webhook %s will have its secret rotated\n", repo.GetFullName(), hookURL(h))
+				continue
+			}
+
+			config := copyHookConfig(h.Config)
+			config["secret"] = cmd.secret
+			if _, _, err := client.Repositories.EditHook(ctx, repo.GetOwner().GetLogin(), repo.GetName(), h.GetID(), &github.Hook{Config: config}); err != nil {
+				return err
+			}
+			fmt.Printf("[OK] %s webhook %s has its secret rotated\n", repo.GetFullName(), hookURL(h))
+		}
+	case "status":
+		for _, h := range hooks {
+			if !cmd.pattern.MatchString(hookURL(h)) {
+				continue
+			}
+
+			if err := cmd.hookStatus(ctx, client, repo, h); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// hookResponse is the last response of a webhook, which the GitHub client
+// does not support yet.
+type hookResponse struct {
+	LastResponse struct {
+		Code    *int   `json:"code"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"last_response"`
+}
+
+// hookDelivery is a delivery of a webhook payload, which the GitHub client
+// does not support yet.
+type hookDelivery struct {
+	ID          int64     `json:"id"`
+	GUID        string    `json:"guid"`
+	DeliveredAt time.Time `json:"delivered_at"`
+	Redelivery  bool      `json:"redelivery"`
+	Status      string    `json:"status"`
+	StatusCode  int       `json:"status_code"`
+	Event       string    `json:"event"`
+}
+
+func (d hookDelivery) failed() bool {
+	return d.StatusCode < 200 || d.StatusCode >= 300
+}
+
+// hookStatus reports the problems with a webhook and redelivers its failed
+// deliveries if --redeliver was passed.
+func (cmd *hooksCommand) hookStatus(ctx context.Context, client *github.Client, repo *github.Repository, h *github.Hook) error {
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+
+	var last hookResponse
+	if _, err := doRequest(ctx, client, "GET", fmt.Sprintf("repos/%s/%s/hooks/%d", owner, name, h.GetID()), nil, &last); err != nil {
+		return err
+	}
+
+	var deliveries []hookDelivery
+	if _, err := doRequest(ctx, client, "GET", fmt.Sprintf("repos/%s/%s/hooks/%d/deliveries?per_page=%d", owner, name, h.GetID(), cmd.deliveries), nil, &deliveries); err != nil {
+		return err
+	}
+
+	problems := []string{}
+	if !h.GetActive() {
+		problems = append(problems, "disabled")
+	}
+	if code := last.LastResponse.Code; code != nil && (*code < 200 || *code >= 300) {
+		problems = append(problems, fmt.Sprintf("last response: %d %s", *code, last.LastResponse.Message))
+	}
+
+	// Deliveries that failed but were redelivered successfully are fine.
+	delivered := map[string]bool{}
+	for _, d := range deliveries {
+		if !d.failed() {
+			delivered[d.GUID] = true
+		}
+	}
+	failed := []hookDelivery{}
+	for _, d := range deliveries {
+		if d.failed() && !delivered[d.GUID] {
+			failed = append(failed, d)
+		}
+	}
+	if len(failed) > 0 {
+		problems = append(problems, fmt.Sprintf("%d/%d recent deliveries failed", len(failed), len(deliveries)))
+	}
+
+	if u, err := url.Parse(hookURL(h)); err != nil || len(u.Hostname()) < 1 {
+		problems = append(problems, "invalid url")
+	} else if _, err := net.LookupHost(u.Hostname()); err != nil {
+		problems = append(problems, fmt.Sprintf("host %s is unreachable", u.Hostname()))
+	}
+
+	if fmt.Sprint(h.Config["insecure_ssl"]) == "1" {
+		problems = append(problems, "insecure_ssl enabled")
+	}
+
+	if len(problems) < 1 {
+		fmt.Printf("[OK] %s webhook %s is healthy\n", repo.GetFullName(), hookURL(h))
+		return nil
+	}
+	fmt.Printf("[WARN] %s webhook %s: %s\n", repo.GetFullName(), hookURL(h), strings.Join(problems, ", "))
+
+	if !cmd.redeliver {
+		return nil
+	}
+
+	// Only redeliver every payload once.
+	redelivered := map[string]bool{}
+	for _, d := range failed {
+		if redelivered[d.GUID] {
+			continue
+		}
+		redelivered[d.GUID] = true
+
+		if dryrun {
+			fmt.Printf("[UPDATE] %s webhook %s delivery %d (%s) will be redelivered\n", repo.GetFullName(), hookURL(h), d.ID, d.Event)
+			continue
+		}
+
+		if _, err := doRequest(ctx, client, "POST", fmt.Sprintf("repos/%s/%s/hooks/%d/deliveries/%d/attempts", owner, name, h.GetID(), d.ID), nil, nil); err != nil {
+			return err
+		}
+		fmt.Printf("[OK] %s webhook %s delivery %d (%s) is redelivered\n", repo.GetFullName(), hookURL(h), d.ID, d.Event)
+	}
+
+	return nil
+}
+
+// ensureHook creates the webhook if there is none for the URL or updates it
+// if its settings differ.
+func (cmd *hooksCommand) ensureHook(ctx context.Context, client *github.Client, repo *github.Repository, hooks []*github.Hook) error {
+	insecureSSL := "0"
+	if cmd.insecureSSL {
+		insecureSSL = "1"
+	}
+	want := &github.Hook{
+		Name:   github.String("web"),
+		Events: sorted(cmd.events),
+		Active: cmd.active.value,
+		Config: map[string]interface{}{
+			"url":          cmd.url,
+			"content_type": cmd.contentType,
+			"insecure_ssl": insecureSSL,
+		},
+	}
+	if len(cmd.secret) > 0 {
+		want.Config["secret"] = cmd.secret
+	}
+
+	var existing *github.Hook
+	for _, h := range hooks {
+		if hookURL(h) == cmd.url {
+			existing = h
+			break
+		}
+	}
+
+	if existing == nil {
+		if dryrun {
+			fmt.Printf("[UPDATE] %s webhook %s will be created\n", repo.GetFullName(), cmd.url)
+			return nil
+		}
+
+		if _, _, err := client.Repositories.CreateHook(ctx, repo.GetOwner().GetLogin(), repo.GetName(), want); err != nil {
+			return err
+		}
+		fmt.Printf("[OK] %s webhook %s is created\n", repo.GetFullName(), cmd.url)
+		return nil
+	}
+
+	changes := []string{}
+	if fmt.Sprint(sorted(existing.Events)) != fmt.Sprint(want.Events) {
+		changes = append(changes, fmt.Sprintf("events: %v -> %v", sorted(existing.Events), want.Events))
+	}
+	if existing.GetActive() != want.GetActive() {
+		changes = append(changes, fmt.Sprintf("active: %t -> %t", existing.GetActive(), want.GetActive()))
+	}
+	for _, key := range []string{"content_type", "insecure_ssl"} {
+		if from := fmt.Sprint(existing.Config[key]); from != want.Config[key] {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", key, from, want.Config[key]))
+		}
+	}
+	if len(changes) < 1 {
+		fmt.Printf("[OK] %s webhook %s is already set\n", repo.GetFullName(), cmd.url)
+		return nil
+	}
+
+	// The config is replaced as a whole, so we can only update a webhook that
+	// has a secret if we know the secret.
+	if _, ok := existing.Config["secret"]; ok && len(cmd.secret) < 1 {
+		return fmt.Errorf("webhook %s for %s has a secret, pass it with --secret-file or --secret-env to update the webhook", cmd.url, repo.GetFullName())
+	}
+
+	if dryrun {
+		fmt.Printf("[UPDATE] %s webhook %s will be changed: %s\n", repo.GetFullName(), cmd.url, strings.Join(changes, ", "))
+		return nil
+	}
+
+	if _, _, err := client.Repositories.EditHook(ctx, repo.GetOwner().GetLogin(), repo.GetName(), existing.GetID(), want); err != nil {
+		return err
+	}
+	fmt.Printf("[OK] %s webhook %s is changed: %s\n", repo.GetFullName(), cmd.url, strings.Join(changes, ", "))
+
+	return nil
+}
+
+// listHooks returns all the webhooks for a repository, following the
+// pagination until the last page.
+func listHooks(ctx context.Context, client *github.Client, repo *github.Repository) ([]*github.Hook, *github.Response, error) {
+	opt := &github.ListOptions{
+		Page:    1,
+		PerPage: 100,
+	}
+
+	all := []*github.Hook{}
+	for {
+		hooks, resp, err := client.Repositories.ListHooks(ctx, repo.GetOwner().GetLogin(), repo.GetName(), opt)
+		if err != nil {
+			return nil, resp, err
+		}
+		all = append(all, hooks...)
+
+		// Return if we are on the last page.
+		if resp.NextPage == 0 {
+			return all, resp, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// hookURL returns the URL the webhook delivers the payloads to.
+func hookURL(h *github.Hook) string {
+	u, _ := h.Config["url"].(string)
+	return u
+}
+
+// copyHookConfig returns a copy of the webhook config without the masked
+// secret returned by the API.
+func copyHookConfig(config map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{}
+	for k, v := range config {
+		if k != "secret" {
+			c[k] = v
+		}
+	}
+	return c
+}
+
+// readSecret reads a secret from the file or the environment variable, the
+// file takes precedence. Surrounding whitespace is trimmed.
+func readSecret(file, env string) (string, error) {
+	if len(file) > 0 {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("reading secret file %s failed: %v", file, err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	if len(env) > 0 {
+		s, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("secret environment variable %s is not set", env)
+		}
+		return strings.TrimSpace(s), nil
+	}
+
+	return "", nil
+}
+
+// globRegexp returns a regular expression matching the whole string against
+// the pattern where '*' matches any characters.
+func globRegexp(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
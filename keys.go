@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const keysHelp = `List, add and remove deploy keys and enforce them to be read-only.`
+
+const keysLongHelp = `List, add and remove deploy keys and enforce them to be read-only.
+
+Actions:
+
+  list                  list the deploy keys with their fingerprint, age and
+                        when they were last used
+  remove                remove the deploy keys older than --older-than, with a
+                        title matching the --title pattern or with the
+                        --fingerprint
+  enforce-ro            replace the deploy keys with write access by the same
+                        key with read-only access, asks for confirmation
+                        unless --yes is passed
+  add                   add the public key from --key-file to the repositories
+                        that do not have a deploy key with the same fingerprint`
+
+func (cmd *keysCommand) Name() string      { return "keys" }
+func (cmd *keysCommand) Args() string      { return "[OPTIONS] ACTION" }
+func (cmd *keysCommand) ShortHelp() string { return keysHelp }
+func (cmd *keysCommand) LongHelp() string  { return keysLongHelp }
+func (cmd *keysCommand) Hidden() bool      { return false }
+
+func (cmd *keysCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.olderThan, "older-than", "", "remove the deploy keys created longer ago than the age (e.g. '90d' or '720h')")
+	fs.StringVar(&cmd.title, "title", "", "title of the deploy key to add, or the pattern of titles to remove")
+	fs.StringVar(&cmd.fingerprint, "fingerprint", "", "SHA256 fingerprint of the deploy keys to remove (e.g. 'SHA256:...')")
+	fs.StringVar(&cmd.keyFile, "key-file", "", "file containing the public key to add")
+	fs.BoolVar(&cmd.readOnly, "read-only", true, "Add the deploy key with read-only access")
+	fs.BoolVar(&cmd.yes, "yes", false, "Do not ask for confirmation before replacing deploy keys")
+}
+
+type keysCommand struct {
+	olderThan   string
+	title       string
+	fingerprint string
+	keyFile     string
+	readOnly    bool
+	yes         bool
+
+	action string
+	maxAge time.Duration
+	key    string
+	stdin  *bufio.Reader
+}
+
+// deployKey is a deploy key of a repository. The GitHub client does not
+// support when the key was created and last used yet.
+type deployKey struct {
+	ID        int64      `json:"id"`
+	Key       string     `json:"key"`
+	URL       string     `json:"url"`
+	Title     string     `json:"title"`
+	ReadOnly  bool       `json:"read_only"`
+	Verified  bool       `json:"verified"`
+	CreatedAt time.Time  `json:"created_at"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+func (cmd *keysCommand) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("must pass an action: list, remove, enforce-ro or add")
+	}
+	cmd.action = args[0]
+
+	switch cmd.action {
+	case "list":
+	case "remove":
+		if len(cmd.olderThan) < 1 && len(cmd.title) < 1 && len(cmd.fingerprint) < 1 {
+			return errors.New("must pass --older-than, --title or --fingerprint to select the deploy keys to remove")
+		}
+		if len(cmd.olderThan) > 0 {
+			var err error
+			cmd.maxAge, err = parseAge(cmd.olderThan)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := path.Match(cmd.title, ""); err != nil {
+			return fmt.Errorf("invalid title pattern %q: %v", cmd.title, err)
+		}
+	case "enforce-ro":
+		cmd.stdin = bufio.NewReader(os.Stdin)
+	case "add":
+		if len(cmd.keyFile) < 1 {
+			return errors.New("must pass the public key to add with --key-file")
+		}
+		b, err := ioutil.ReadFile(cmd.keyFile)
+		if err != nil {
+			return fmt.Errorf("reading key file %s failed: %v", cmd.keyFile, err)
+		}
+		cmd.key = strings.TrimSpace(string(b))
+		cmd.fingerprint, err = fingerprint(cmd.key)
+		if err != nil {
+			return fmt.Errorf("parsing key file %s failed: %v", cmd.keyFile, err)
+		}
+		if len(cmd.title) < 1 {
+			// Use the comment of the key as the title.
+			if fields := strings.Fields(cmd.key); len(fields) > 2 {
+				cmd.title = strings.Join(fields[2:], " ")
+			}
+		}
+		if len(cmd.title) < 1 {
+			return errors.New("must pass the title of the deploy key with --title")
+		}
+	default:
+		return fmt.Errorf("unknown action %q, must be one of list, remove, enforce-ro or add", cmd.action)
+	}
+
+	return runCommand(ctx, cmd.handleRepoKeys)
+}
+
+// handleRepoKeys will return nil error if the user does not have access to something.
+func (cmd *keysCommand) handleRepoKeys(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	keys, resp, err := listDeployKeys(ctx, client, repo)
+	if resp == nil || resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden || err != nil {
+		if _, ok := err.(*github.RateLimitError); ok {
+			return err
+		}
+
+		return nil
+	}
+
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+
+	switch cmd.action {
+	case "list":
+		for _, k := range keys {
+			fp, _ := fingerprint(k.Key)
+			lastUsed := "never"
+			if k.LastUsed != nil {
+				lastUsed = k.LastUsed.Format("2006-01-02")
+			}
+			fmt.Printf("%s: %s %s - ro:%t age:%dd last used:%s\n", repo.GetFullName(), k.Title, fp, k.ReadOnly, int(time.Since(k.CreatedAt).Hours()/24), lastUsed)
+		}
+	case "remove":
+		for _, k := range keys {
+			if !cmd.matchKey(k) {
+				continue
+			}
+
+			if dryrun {
+				fmt.Printf("[UPDATE] %s deploy key %s will be removed\n", repo.GetFullName(), k.Title)
+				continue
+			}
+
+			if _, err := client.Repositories.DeleteKey(ctx, owner, name, k.ID); err != nil {
+				return err
+			}
+			fmt.Printf("[OK] %s deploy key %s is removed\n", repo.GetFullName(), k.Title)
+		}
+	case "enforce-ro":
+		for _, k := range keys {
+			if k.ReadOnly {
+				continue
+			}
+
+			if dryrun {
+				fmt.Printf("[UPDATE] %s deploy key %s will be replaced with a read-only key\n", repo.GetFullName(), k.Title)
+				continue
+			}
+
+			if !cmd.yes {
+				ok, err := cmd.confirm(fmt.Sprintf("Replace deploy key %s of %s with a read-only key?", k.Title, repo.GetFullName()))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+			}
+
+			// The same key can not be added twice, so remove it first.
+			if _, err := client.Repositories.DeleteKey(ctx, owner, name, k.ID); err != nil {
+				return err
+			}
+			if _, _, err := client.Repositories.CreateKey(ctx, owner, name, &github.Key{
+				Title:    github.String(k.Title),
+				Key:      github.String(k.Key),
+				ReadOnly: github.Bool(true),
+			}); err != nil {
+				return fmt.Errorf("adding deploy key %s back to %s failed after it was removed: %v", k.Title, repo.GetFullName(), err)
+			}
+			fmt.Printf("[OK] %s deploy key %s is replaced with a read-only key\n", repo.GetFullName(), k.Title)
+		}
+	case "add":
+		for _, k := range keys {
+			if fp, _ := fingerprint(k.Key); fp == cmd.fingerprint {
+				fmt.Printf("[OK] %s already has deploy key %s (%s, ro:%t)\n", repo.GetFullName(), k.Title, cmd.fingerprint, k.ReadOnly)
+				return nil
+			}
+		}
+
+		if dryrun {
+			fmt.Printf("[UPDATE] %s will have deploy key %s added (%s, ro:%t)\n", repo.GetFullName(), cmd.title, cmd.fingerprint, cmd.readOnly)
+			return nil
+		}
+
+		if _, _, err := client.Repositories.CreateKey(ctx, owner, name, &github.Key{
+			Title:    github.String(cmd.title),
+			Key:      github.String(cmd.key),
+			ReadOnly: github.Bool(cmd.readOnly),
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("[OK] %s has deploy key %s added (%s, ro:%t)\n", repo.GetFullName(), cmd.title, cmd.fingerprint, cmd.readOnly)
+	}
+
+	return nil
+}
+
+// matchKey returns true if the deploy key matches any of the criteria passed
+// on the command line.
+func (cmd *keysCommand) matchKey(k deployKey) bool {
+	if cmd.maxAge > 0 && time.Since(k.CreatedAt) > cmd.maxAge {
+		return true
+	}
+	if len(cmd.title) > 0 {
+		if ok, _ := path.Match(cmd.title, k.Title); ok {
+			return true
+		}
+	}
+	if len(cmd.fingerprint) > 0 {
+		if fp, _ := fingerprint(k.Key); fp == cmd.fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// confirm asks the question on stdout and returns true if it was answered
+// with yes.
+func (cmd *keysCommand) confirm(question string) (bool, error) {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := cmd.stdin.ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// listDeployKeys returns all the deploy keys for a repository, following the
+// pagination until the last page.
+func listDeployKeys(ctx context.Context, client *github.Client, repo *github.Repository) ([]deployKey, *github.Response, error) {
+	all := []deployKey{}
+	for page := 1; ; {
+		var keys []deployKey
+		resp, err := doRequest(ctx, client, "GET", fmt.Sprintf("repos/%s/%s/keys?per_page=100&page=%d", repo.GetOwner().GetLogin(), repo.GetName(), page), nil, &keys)
+		if err != nil {
+			return nil, resp, err
+		}
+		all = append(all, keys...)
+
+		// Return if we are on the last page.
+		if resp.NextPage == 0 {
+			return all, resp, nil
+		}
+		page = resp.NextPage
+	}
+}
+
+// fingerprint returns the SHA256 fingerprint of a public key in the
+// authorized_keys format, the same as `ssh-keygen -l` prints.
+func fingerprint(key string) (string, error) {
+	fields := strings.Fields(key)
+	if len(fields) < 2 {
+		return "", errors.New("public key must be in the format 'TYPE KEY [COMMENT]'")
+	}
+
+	b, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("decoding public key failed: %v", err)
+	}
+
+	sum := sha256.Sum256(b)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// parseAge parses a duration that can also be given in days, e.g. '90d'.
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("parsing age %q failed: %v", s, err)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("parsing age %q failed: %v", s, err)
+	}
+	return d, nil
+}
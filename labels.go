@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const labelsHelp = `Sync the issue labels of the repositories with a definition file.`
+
+const labelsLongHelp = `Sync the issue labels of the repositories with a definition file.
+
+Actions:
+
+  sync -f FILE          create and update the labels so every repository
+                        matches the YAML file, labels that are not in the file
+                        are deleted with --prune
+  export                print the labels of the repository passed with --repo
+                        as YAML to bootstrap the file
+
+Labels that exist under one of the aliases are renamed, so existing issues and
+pull requests keep their labels:
+
+  - name: bug
+    color: d73a4a
+    description: Something isn't working
+    aliases: [kind/bug, "type: bug"]`
+
+func (cmd *labelsCommand) Name() string      { return "labels" }
+func (cmd *labelsCommand) Args() string      { return "[OPTIONS] ACTION" }
+func (cmd *labelsCommand) ShortHelp() string { return labelsHelp }
+func (cmd *labelsCommand) LongHelp() string  { return labelsLongHelp }
+func (cmd *labelsCommand) Hidden() bool      { return false }
+
+func (cmd *labelsCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.file, "file", "", "YAML file containing the label definitions")
+	fs.StringVar(&cmd.file, "f", "", "YAML file containing the label definitions")
+	fs.BoolVar(&cmd.prune, "prune", false, "Delete the labels that are not in the definition file")
+}
+
+type labelsCommand struct {
+	file  string
+	prune bool
+
+	action string
+	labels []labelDefinition
+}
+
+// labelDefinition is a label every repository should have.
+type labelDefinition struct {
+	Name        string   `yaml:"name"`
+	Color       string   `yaml:"color"`
+	Description string   `yaml:"description,omitempty"`
+	Aliases     []string `yaml:"aliases,omitempty"`
+}
+
+func (cmd *labelsCommand) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("must pass an action: sync or export")
+	}
+	cmd.action = args[0]
+
+	switch cmd.action {
+	case "sync":
+		if len(cmd.file) < 1 {
+			return errors.New("must pass a labels file with --file to sync")
+		}
+		b, err := ioutil.ReadFile(cmd.file)
+		if err != nil {
+			return fmt.Errorf("reading labels file %s failed: %v", cmd.file, err)
+		}
+		if err := yaml.UnmarshalStrict(b, &cmd.labels); err != nil {
+			return fmt.Errorf("parsing labels file %s failed: %v", cmd.file, err)
+		}
+		for i, l := range cmd.labels {
+			if len(l.Name) < 1 {
+				return fmt.Errorf("label %d in %s has no name", i+1, cmd.file)
+			}
+			cmd.labels[i].Color = normalizeColor(l.Color)
+		}
+	case "export":
+		if len(singleRepo) < 1 {
+			return errors.New("must pass the repository to export the labels from with --repo")
+		}
+	default:
+		return fmt.Errorf("unknown action %q, must be one of sync or export", cmd.action)
+	}
+
+	return runCommand(ctx, cmd.handleRepoLabels)
+}
+
+// handleRepoLabels will return nil error if the user does not have access to something.
+func (cmd *labelsCommand) handleRepoLabels(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	existing, resp, err := listLabels(ctx, client, repo)
+	if resp == nil || resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden || err != nil {
+		if _, ok := err.(*github.RateLimitError); ok {
+			return err
+		}
+
+		return nil
+	}
+
+	if cmd.action == "export" {
+		defs := []labelDefinition{}
+		for _, l := range existing {
+			defs = append(defs, labelDefinition{
+				Name:        l.GetName(),
+				Color:       l.GetColor(),
+				Description: l.GetDescription(),
+			})
+		}
+		b, err := yaml.Marshal(defs)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+
+	changed := false
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+	// keep holds the names of the existing labels that are in the definitions,
+	// so we know which ones to prune.
+	keep := map[string]bool{}
+
+	for _, def := range cmd.labels {
+		label := findLabel(existing, def.Name)
+
+		// Rename the label if it only exists under one of the aliases.
+		var alias *github.Label
+		for _, a := range def.Aliases {
+			if l := findLabel(existing, a); l != nil {
+				if label == nil && alias == nil {
+					alias = l
+					continue
+				}
+				keep[strings.ToLower(l.GetName())] = true
+				logrus.Warnf("%s has both label %s and its alias %s, merge them by hand", repo.GetFullName(), def.Name, l.GetName())
+			}
+		}
+
+		edit := &github.Label{
+			Name:        github.String(def.Name),
+			Color:       github.String(def.Color),
+			Description: github.String(def.Description),
+		}
+
+		switch {
+		case label == nil && alias == nil:
+			changed = true
+			if dryrun {
+				fmt.Printf("[UPDATE] %s label %s will be created\n", repo.GetFullName(), def.Name)
+				continue
+			}
+			if _, _, err := client.Issues.CreateLabel(ctx, owner, name, edit); err != nil {
+				return err
+			}
+			fmt.Printf("[OK] %s label %s is created\n", repo.GetFullName(), def.Name)
+		case label == nil:
+			changed = true
+			keep[strings.ToLower(alias.GetName())] = true
+			if dryrun {
+				fmt.Printf("[UPDATE] %s label %s will be renamed to %s\n", repo.GetFullName(), alias.GetName(), def.Name)
+				continue
+			}
+			if _, _, err := client.Issues.EditLabel(ctx, owner, name, url.PathEscape(alias.GetName()), edit); err != nil {
+				return err
+			}
+			fmt.Printf("[OK] %s label %s is renamed to %s\n", repo.GetFullName(), alias.GetName(), def.Name)
+		default:
+			keep[strings.ToLower(label.GetName())] = true
+			changes := diffLabel(label, def)
+			if len(changes) < 1 {
+				continue
+			}
+			changed = true
+			if dryrun {
+				fmt.Printf("[UPDATE] %s label %s will be changed: %s\n", repo.GetFullName(), def.Name, strings.Join(changes, ", "))
+				continue
+			}
+			if _, _, err := client.Issues.EditLabel(ctx, owner, name, url.PathEscape(label.GetName()), edit); err != nil {
+				return err
+			}
+			fmt.Printf("[OK] %s label %s is changed: %s\n", repo.GetFullName(), def.Name, strings.Join(changes, ", "))
+		}
+	}
+
+	if cmd.prune {
+		for _, l := range existing {
+			if keep[strings.ToLower(l.GetName())] {
+				continue
+			}
+			changed = true
+			if dryrun {
+				fmt.Printf("[UPDATE] %s label %s will be deleted\n", repo.GetFullName(), l.GetName())
+				continue
+			}
+			if _, err := client.Issues.DeleteLabel(ctx, owner, name, url.PathEscape(l.GetName())); err != nil {
+				return err
+			}
+			fmt.Printf("[OK] %s label %s is deleted\n", repo.GetFullName(), l.GetName())
+		}
+	}
+
+	if !changed {
+		fmt.Printf("[OK] %s labels are already in sync\n", repo.GetFullName())
+	}
+
+	return nil
+}
+
+// listLabels returns all the labels for a repository, following the
+// pagination until the last page.
+func listLabels(ctx context.Context, client *github.Client, repo *github.Repository) ([]*github.Label, *github.Response, error) {
+	opt := &github.ListOptions{
+		Page:    1,
+		PerPage: 100,
+	}
+
+	all := []*github.Label{}
+	for {
+		labels, resp, err := client.Issues.ListLabels(ctx, repo.GetOwner().GetLogin(), repo.GetName(), opt)
+		if err != nil {
+			return nil, resp, err
+		}
+		all = append(all, labels...)
+
+		// Return if we are on the last page.
+		if resp.NextPage == 0 {
+			return all, resp, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// findLabel returns the label with the name, label names are case insensitive.
+func findLabel(labels []*github.Label, name string) *github.Label {
+	for _, l := range labels {
+		if strings.EqualFold(l.GetName(), name) {
+			return l
+		}
+	}
+	return nil
+}
+
+// diffLabel returns the settings that differ between the existing label and
+// its definition.
+func diffLabel(label *github.Label, def labelDefinition) []string {
+	changes := []string{}
+	if label.GetName() != def.Name {
+		changes = append(changes, fmt.Sprintf("name: %s -> %s", label.GetName(), def.Name))
+	}
+	if normalizeColor(label.GetColor()) != def.Color {
+		changes = append(changes, fmt.Sprintf("color: %s -> %s", label.GetColor(), def.Color))
+	}
+	if label.GetDescription() != def.Description {
+		changes = append(changes, fmt.Sprintf("description: %q -> %q", label.GetDescription(), def.Description))
+	}
+	return changes
+}
+
+// normalizeColor returns the color in the format used by the API, lowercase
+// hex without the leading '#'.
+func normalizeColor(color string) string {
+	return strings.ToLower(strings.TrimPrefix(color, "#"))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const listHelp = `List the repositories the other commands would act on.`
+
+func (cmd *listCommand) Name() string      { return "list" }
+func (cmd *listCommand) Args() string      { return "[OPTIONS]" }
+func (cmd *listCommand) ShortHelp() string { return listHelp }
+func (cmd *listCommand) LongHelp() string  { return listHelp }
+func (cmd *listCommand) Hidden() bool      { return false }
+
+func (cmd *listCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.sort, "sort", "name", "sort the repositories by name, pushed, stars or issues")
+	fs.StringVar(&cmd.format, "format", "table", "output format (table or json)")
+}
+
+type listCommand struct {
+	sort   string
+	format string
+
+	repos []repoListing
+}
+
+// repoListing is a row in the list of repositories.
+type repoListing struct {
+	Name          string    `json:"name"`
+	Visibility    string    `json:"visibility"`
+	Archived      bool      `json:"archived"`
+	Fork          bool      `json:"fork"`
+	DefaultBranch string    `json:"default_branch"`
+	Language      string    `json:"language"`
+	Topics        []string  `json:"topics"`
+	PushedAt      time.Time `json:"pushed_at"`
+	Stars         int       `json:"stars"`
+	OpenIssues    int       `json:"open_issues"`
+}
+
+func (cmd *listCommand) Run(ctx context.Context, args []string) error {
+	if !in([]string{"name", "pushed", "stars", "issues"}, cmd.sort) {
+		return errors.New("sort must be one of name, pushed, stars or issues")
+	}
+	if cmd.format != "table" && cmd.format != "json" {
+		return errors.New("format must be one of table or json")
+	}
+
+	if err := runCommand(ctx, cmd.handleRepoList); err != nil {
+		return err
+	}
+
+	sort.SliceStable(cmd.repos, func(i, j int) bool {
+		a, b := cmd.repos[i], cmd.repos[j]
+		switch cmd.sort {
+		case "pushed":
+			return a.PushedAt.After(b.PushedAt)
+		case "stars":
+			return a.Stars > b.Stars
+		case "issues":
+			return a.OpenIssues > b.OpenIssues
+		}
+		return a.Name < b.Name
+	})
+
+	if cmd.format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cmd.repos)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 20, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVISIBILITY\tARCHIVED\tFORK\tDEFAULT BRANCH\tLANGUAGE\tTOPICS\tLAST PUSH\tSTARS\tOPEN ISSUES")
+	for _, r := range cmd.repos {
+		pushed := "never"
+		if !r.PushedAt.IsZero() {
+			pushed = r.PushedAt.Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%s\t%s\t%s\t%s\t%d\t%d\n", r.Name, r.Visibility, r.Archived, r.Fork, r.DefaultBranch, r.Language, strings.Join(r.Topics, ","), pushed, r.Stars, r.OpenIssues)
+	}
+	return w.Flush()
+}
+
+// handleRepoList collects the repository so they can be sorted and printed
+// once all of them are known.
+func (cmd *listCommand) handleRepoList(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	visibility := "public"
+	if repo.GetPrivate() {
+		visibility = "private"
+	}
+
+	cmd.repos = append(cmd.repos, repoListing{
+		Name:          repo.GetFullName(),
+		Visibility:    visibility,
+		Archived:      repo.GetArchived(),
+		Fork:          repo.GetFork(),
+		DefaultBranch: repo.GetDefaultBranch(),
+		Language:      repo.GetLanguage(),
+		Topics:        append([]string{}, repo.Topics...),
+		PushedAt:      repo.GetPushedAt().Time,
+		Stars:         repo.GetStargazersCount(),
+		OpenIssues:    repo.GetOpenIssuesCount(),
+	})
+
+	return nil
+}
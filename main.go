@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -43,6 +44,77 @@ func (s *stringSlice) Set(value string) error {
 	return nil
 }
 
+// optionalBool is a boolean flag that records whether it was passed at all,
+// so settings that were not passed can be left untouched.
+type optionalBool struct {
+	value *bool
+}
+
+// implement the flag interface for optionalBool
+func (b *optionalBool) String() string {
+	if b.value == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b.value)
+}
+func (b *optionalBool) Set(value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	b.value = &v
+	return nil
+}
+func (b *optionalBool) IsBoolFlag() bool { return true }
+
+// optionalInt is an integer flag that records whether it was passed at all,
+// so settings that were not passed can be left untouched.
+type optionalInt struct {
+	value *int
+}
+
+// implement the flag interface for optionalInt
+func (i *optionalInt) String() string {
+	if i.value == nil {
+		return ""
+	}
+	return strconv.Itoa(*i.value)
+}
+func (i *optionalInt) Set(value string) error {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	i.value = &v
+	return nil
+}
+
+// optionalStringFlag is a string flag that records whether it was passed at
+// all, so an empty value can be told apart from a setting that was not passed.
+type optionalStringFlag struct {
+	value *string
+}
+
+// implement the flag interface for optionalStringFlag
+func (s *optionalStringFlag) String() string {
+	if s.value == nil {
+		return ""
+	}
+	return *s.value
+}
+func (s *optionalStringFlag) Set(value string) error {
+	s.value = &value
+	return nil
+}
+
+// optionalString returns a pointer to the string or nil if it is empty.
+func optionalString(s string) *string {
+	if len(s) < 1 {
+		return nil
+	}
+	return &s
+}
+
 func main() {
 	// Create a new cli program.
 	p := cli.NewProgram()
@@ -57,9 +129,16 @@ func main() {
 	p.Commands = []cli.Command{
 		&auditCommand{},
 		&collaboratorsCommand{},
+		&hooksCommand{},
+		&keysCommand{},
+		&labelsCommand{},
+		&listCommand{},
 		&mergeCommand{},
 		&protectCommand{},
 		&releaseCommand{},
+		&rulesetsCommand{},
+		&settingsCommand{},
+		&topicsCommand{},
 	}
 
 	// Setup the global flags.
@@ -104,7 +183,7 @@ func main() {
 
 func runCommand(ctx context.Context, cmd func(context.Context, *github.Client, *github.Repository) error) error {
 	// On ^C, or SIGTERM handle exit.
-	signals := make(chan os.Signal)
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt)
 	signal.Notify(signals, syscall.SIGTERM)
 	var cancel context.CancelFunc
@@ -117,20 +196,10 @@ func runCommand(ctx context.Context, cmd func(context.Context, *github.Client, *
 		}
 	}()
 
-	// Create the http client.
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-
 	// Create the github client.
-	client := github.NewClient(tc)
-	if enturl != "" {
-		var err error
-		client.BaseURL, err = url.Parse(enturl + "/api/v3/")
-		if err != nil {
-			return fmt.Errorf("parsing URL for enterprise failed: %v", err)
-		}
+	client, err := newClient(ctx)
+	if err != nil {
+		return err
 	}
 
 	// Affiliation must be set before we add the user to the "orgs".
@@ -168,6 +237,40 @@ func runCommand(ctx context.Context, cmd func(context.Context, *github.Client, *
 	return nil
 }
 
+// newClient returns a GitHub client authenticated with the token, pointed at
+// the GitHub Enterprise URL if one was given.
+func newClient(ctx context.Context) (*github.Client, error) {
+	// Create the http client.
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: token},
+	)
+	tc := oauth2.NewClient(ctx, ts)
+
+	// Create the github client.
+	client := github.NewClient(tc)
+	if enturl != "" {
+		var err error
+		client.BaseURL, err = url.Parse(enturl + "/api/v3/")
+		if err != nil {
+			return nil, fmt.Errorf("parsing URL for enterprise failed: %v", err)
+		}
+	}
+
+	return client, nil
+}
+
+// doRequest sends a request to an API endpoint the GitHub client does not
+// support yet and decodes the response into v.
+func doRequest(ctx context.Context, client *github.Client, method, u string, body, v interface{}) (*github.Response, error) {
+	req, err := client.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	return client.Do(ctx, req, v)
+}
+
 func getRepositories(ctx context.Context, client *github.Client, page, perPage int, affiliation string, cmd func(context.Context, *github.Client, *github.Repository) error) error {
 	opt := &github.RepositoryListOptions{
 		Affiliation: affiliation,
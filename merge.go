@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"reflect"
 	"strings"
 
 	"github.com/google/go-github/github"
@@ -23,47 +24,170 @@ func (cmd *mergeCommand) Register(fs *flag.FlagSet) {
 	fs.BoolVar(&cmd.commits, "commits", false, "Allow merge commits, add all commits from the head branch to the base branch with a merge commit")
 	fs.BoolVar(&cmd.squash, "squash", false, "Allow squash merging, combine all commits from the head branch into a single commit in the base branch")
 	fs.BoolVar(&cmd.rebase, "rebase", false, "Allow rebase merging, add all commits from the head branch onto the base branch individually")
+
+	fs.Var(&cmd.deleteBranch, "delete-branch-on-merge", "Automatically delete head branches after pull requests are merged")
+	fs.Var(&cmd.autoMerge, "auto-merge", "Allow auto-merge on pull requests")
+	fs.Var(&cmd.updateBranch, "update-branch", "Always suggest updating pull request branches")
+	fs.StringVar(&cmd.squashTitle, "squash-title", "", "Default title for squash merge commits (PR_TITLE or COMMIT_OR_PR_TITLE)")
+	fs.StringVar(&cmd.squashMessage, "squash-message", "", "Default message for squash merge commits (PR_BODY, COMMIT_MESSAGES or BLANK)")
+	fs.StringVar(&cmd.mergeTitle, "merge-title", "", "Default title for merge commits (PR_TITLE or MERGE_MESSAGE)")
+	fs.StringVar(&cmd.mergeMessage, "merge-message", "", "Default message for merge commits (PR_BODY, PR_TITLE or BLANK)")
 }
 
 type mergeCommand struct {
 	commits bool
 	squash  bool
 	rebase  bool
+
+	deleteBranch  optionalBool
+	autoMerge     optionalBool
+	updateBranch  optionalBool
+	squashTitle   string
+	squashMessage string
+	mergeTitle    string
+	mergeMessage  string
+
+	want mergeSettings
+}
+
+// mergeSettings are the pull request settings of a repository. Settings that
+// are nil are left untouched. Not all of them are supported by the GitHub
+// client yet, so they are read and edited with their own requests.
+type mergeSettings struct {
+	AllowMergeCommit         *bool   `json:"allow_merge_commit,omitempty"`
+	AllowSquashMerge         *bool   `json:"allow_squash_merge,omitempty"`
+	AllowRebaseMerge         *bool   `json:"allow_rebase_merge,omitempty"`
+	DeleteBranchOnMerge      *bool   `json:"delete_branch_on_merge,omitempty"`
+	AllowAutoMerge           *bool   `json:"allow_auto_merge,omitempty"`
+	AllowUpdateBranch        *bool   `json:"allow_update_branch,omitempty"`
+	SquashMergeCommitTitle   *string `json:"squash_merge_commit_title,omitempty"`
+	SquashMergeCommitMessage *string `json:"squash_merge_commit_message,omitempty"`
+	MergeCommitTitle         *string `json:"merge_commit_title,omitempty"`
+	MergeCommitMessage       *string `json:"merge_commit_message,omitempty"`
 }
 
 func (cmd *mergeCommand) Run(ctx context.Context, args []string) error {
+	for name, v := range map[string]struct {
+		value   string
+		allowed []string
+	}{
+		"squash-title":   {cmd.squashTitle, []string{"PR_TITLE", "COMMIT_OR_PR_TITLE"}},
+		"squash-message": {cmd.squashMessage, []string{"PR_BODY", "COMMIT_MESSAGES", "BLANK"}},
+		"merge-title":    {cmd.mergeTitle, []string{"PR_TITLE", "MERGE_MESSAGE"}},
+		"merge-message":  {cmd.mergeMessage, []string{"PR_BODY", "PR_TITLE", "BLANK"}},
+	} {
+		if len(v.value) > 0 && !in(v.allowed, v.value) {
+			return fmt.Errorf("%s must be one of %s", name, strings.Join(v.allowed, ", "))
+		}
+	}
+
+	// GitHub validates the title and the message of the commits together and
+	// only allows some combinations of them.
+	for _, v := range []struct {
+		kind           string
+		title, message string
+		allowed        map[string][]string
+	}{
+		{"squash", cmd.squashTitle, cmd.squashMessage, map[string][]string{
+			"PR_TITLE":           {"PR_BODY", "COMMIT_MESSAGES", "BLANK"},
+			"COMMIT_OR_PR_TITLE": {"COMMIT_MESSAGES"},
+		}},
+		{"merge", cmd.mergeTitle, cmd.mergeMessage, map[string][]string{
+			"PR_TITLE":      {"PR_BODY", "BLANK"},
+			"MERGE_MESSAGE": {"PR_TITLE"},
+		}},
+	} {
+		if (len(v.title) > 0) != (len(v.message) > 0) {
+			return fmt.Errorf("%s-title and %s-message must be passed together", v.kind, v.kind)
+		}
+		if len(v.title) > 0 && !in(v.allowed[v.title], v.message) {
+			return fmt.Errorf("%s-title %s can only be combined with %s-message %s", v.kind, v.title, v.kind, strings.Join(v.allowed[v.title], " or "))
+		}
+	}
+
+	cmd.want = mergeSettings{
+		DeleteBranchOnMerge:      cmd.deleteBranch.value,
+		AllowAutoMerge:           cmd.autoMerge.value,
+		AllowUpdateBranch:        cmd.updateBranch.value,
+		SquashMergeCommitTitle:   optionalString(cmd.squashTitle),
+		SquashMergeCommitMessage: optionalString(cmd.squashMessage),
+		MergeCommitTitle:         optionalString(cmd.mergeTitle),
+		MergeCommitMessage:       optionalString(cmd.mergeMessage),
+	}
+
+	// The merge types are only changed if at least one of them was chosen,
+	// the others are then disallowed.
+	if cmd.commits || cmd.squash || cmd.rebase {
+		cmd.want.AllowMergeCommit = &cmd.commits
+		cmd.want.AllowSquashMerge = &cmd.squash
+		cmd.want.AllowRebaseMerge = &cmd.rebase
+	}
+
+	if reflect.DeepEqual(cmd.want, mergeSettings{}) {
+		return errors.New("you must choose from commits, squash, and/or rebase or pass one of the other merge settings")
+	}
+
 	return runCommand(ctx, cmd.handleRepoMergeOpt)
 }
 
 // handleRepo will return nil error if the user does not have access to something.
 func (cmd *mergeCommand) handleRepoMergeOpt(ctx context.Context, client *github.Client, repo *github.Repository) error {
-	if !cmd.commits && !cmd.squash && !cmd.rebase {
-		return errors.New("you must choose from commits, squash, and/or rebase")
+	var current mergeSettings
+	resp, err := getSettings(ctx, client, repo, &current)
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+		return nil
 	}
-
-	repo, resp, err := client.Repositories.Get(ctx, repo.GetOwner().GetLogin(), repo.GetName())
-	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden || err != nil {
+	if err != nil {
 		if _, ok := err.(*github.RateLimitError); ok {
 			return err
 		}
+		return fmt.Errorf("getting merge settings for %s failed: %v", repo.GetFullName(), err)
+	}
 
+	changes := diffSettings(current, cmd.want)
+	desc := cmd.describe()
+
+	if dryrun && len(changes) > 0 {
+		fmt.Printf("[UPDATE] %s will be changed to %s\n", repo.GetFullName(), desc)
+		printSettingChanges(changes)
 		return nil
 	}
-	if err != nil {
-		return err
+
+	if len(changes) < 1 {
+		fmt.Printf("[OK] %s is already set to %s\n", repo.GetFullName(), desc)
+		return nil
 	}
 
-	willBeUpdated := false
-	if repo.GetAllowMergeCommit() != cmd.commits {
-		willBeUpdated = true
+	// Edit the repo settings, only sending the ones that changed.
+	var edit mergeSettings
+	setChangedSettings(&edit, cmd.want, changes)
+	// The commit title and message defaults are validated together, so send
+	// both if one of them changed.
+	if edit.SquashMergeCommitTitle != nil || edit.SquashMergeCommitMessage != nil {
+		edit.SquashMergeCommitTitle, edit.SquashMergeCommitMessage = cmd.want.SquashMergeCommitTitle, cmd.want.SquashMergeCommitMessage
+	}
+	if edit.MergeCommitTitle != nil || edit.MergeCommitMessage != nil {
+		edit.MergeCommitTitle, edit.MergeCommitMessage = cmd.want.MergeCommitTitle, cmd.want.MergeCommitMessage
 	}
-	if repo.GetAllowSquashMerge() != cmd.squash {
-		willBeUpdated = true
+
+	resp, err = editSettings(ctx, client, repo, edit)
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+		return nil
 	}
-	if repo.GetAllowRebaseMerge() != cmd.rebase {
-		willBeUpdated = true
+	if err != nil {
+		if _, ok := err.(*github.RateLimitError); ok {
+			return err
+		}
+		return fmt.Errorf("editing merge settings for %s failed: %v", repo.GetFullName(), err)
 	}
+	fmt.Printf("[OK] %s is set to %s\n", repo.GetFullName(), desc)
+	printSettingChanges(changes)
+
+	return nil
+}
 
+// describe returns the wanted settings in a human readable form.
+func (cmd *mergeCommand) describe() string {
 	opt := []string{}
 	if cmd.commits {
 		opt = append(opt, "mergeCommits")
@@ -75,32 +199,13 @@ func (cmd *mergeCommand) handleRepoMergeOpt(ctx context.Context, client *github.
 		opt = append(opt, "rebase")
 	}
 
-	if dryrun && willBeUpdated {
-		fmt.Printf("[UPDATE] %s will be changed to %s\n", *repo.FullName, strings.Join(opt, " | "))
-		return nil
-	}
-
-	if !willBeUpdated {
-		fmt.Printf("[OK] %s is already set to %s\n", *repo.FullName, strings.Join(opt, " | "))
-		return nil
-	}
-
-	// Edit the repo settings.
-	repo.AllowRebaseMerge = &cmd.rebase
-	repo.AllowSquashMerge = &cmd.squash
-	repo.AllowMergeCommit = &cmd.commits
-	repo, resp, err = client.Repositories.Edit(ctx, repo.GetOwner().GetLogin(), repo.GetName(), repo)
-	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden || err != nil {
-		if _, ok := err.(*github.RateLimitError); ok {
-			return err
+	for _, c := range diffSettings(mergeSettings{}, cmd.want) {
+		if in([]string{"allow_merge_commit", "allow_squash_merge", "allow_rebase_merge"}, c.field) {
+			// The merge types are already described above.
+			continue
 		}
-
-		return nil
+		opt = append(opt, fmt.Sprintf("%s=%s", c.field, c.to))
 	}
-	if err != nil {
-		return err
-	}
-	fmt.Printf("[OK] %s is set to %s\n", *repo.FullName, strings.Join(opt, " | "))
 
-	return nil
+	return strings.Join(opt, " | ")
 }
@@ -2,74 +2,610 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
+	"path"
+	"sort"
+	"strings"
 
 	"github.com/google/go-github/github"
 )
 
-const protectHelp = `Protect the master branch.`
+const protectHelp = `Protect the default branch or branches matching names and patterns.`
+
+const protectLongHelp = `Protect the default branch or branches matching names and patterns.
+
+Only the settings passed as flags are changed, the rest of the protection of
+branches that are already protected is left untouched.
+
+Use --tags to protect tags matching the patterns instead of branches with a
+tag ruleset, patterns that are not in the list are removed from it.
+
+Use --from to copy the protection of a branch in a reference repository
+instead of building it from the flags, and --remove to remove the protection
+from the selected branches instead.`
 
 func (cmd *protectCommand) Name() string      { return "protect" }
 func (cmd *protectCommand) Args() string      { return "[OPTIONS]" }
 func (cmd *protectCommand) ShortHelp() string { return protectHelp }
-func (cmd *protectCommand) LongHelp() string  { return protectHelp }
+func (cmd *protectCommand) LongHelp() string  { return protectLongHelp }
 func (cmd *protectCommand) Hidden() bool      { return false }
 
-func (cmd *protectCommand) Register(fs *flag.FlagSet) {}
+func (cmd *protectCommand) Register(fs *flag.FlagSet) {
+	fs.Var(&cmd.branches, "branch", "branch to protect, can be passed multiple times (defaults to the repository's default branch)")
+	fs.Var(&cmd.patterns, "pattern", "glob pattern of branches to protect (e.g. 'release/*'), can be passed multiple times")
+	fs.Var(&cmd.tags, "tags", "protect tags matching the pattern (e.g. 'v*') instead of branches, can be passed multiple times")
+
+	fs.Var(&cmd.strict, "strict", "Require branches to be up to date before merging")
+	fs.Var(&cmd.contexts, "contexts", "status check contexts required to pass before merging, can be passed multiple times")
+	fs.Var(&cmd.reviews, "reviews", "number of approving reviews required before merging (0 disables required reviews)")
+	fs.Var(&cmd.dismissStale, "dismiss-stale-reviews", "Dismiss approved reviews automatically when a new commit is pushed")
+	fs.Var(&cmd.codeOwners, "code-owner-reviews", "Require an approved review from a code owner")
+	fs.Var(&cmd.enforceAdmins, "enforce-admins", "Enforce all configured restrictions for administrators")
+
+	fs.StringVar(&cmd.from, "from", "", "copy the protection from a reference repository branch (e.g. 'genuinetools/img:main'), overrides the protection flags")
+	fs.BoolVar(&cmd.remove, "remove", false, "Remove the protection from the selected branches")
+}
+
+type protectCommand struct {
+	branches stringSlice
+	patterns stringSlice
+	tags     stringSlice
+
+	strict        optionalBool
+	contexts      stringSlice
+	reviews       optionalInt
+	dismissStale  optionalBool
+	codeOwners    optionalBool
+	enforceAdmins optionalBool
 
-type protectCommand struct{}
+	from   string
+	remove bool
+
+	// fromProtection is the protection of the reference branch passed with
+	// --from, it replaces the protection flags.
+	fromProtection *github.ProtectionRequest
+}
 
 func (cmd *protectCommand) Run(ctx context.Context, args []string) error {
-	return runCommand(ctx, handleRepoProtectBranch)
+	for _, p := range cmd.patterns {
+		// Validate the patterns before we start making requests.
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid branch pattern %q: %v", p, err)
+		}
+	}
+
+	if len(cmd.tags) > 0 {
+		return runCommand(ctx, cmd.handleRepoProtectTags)
+	}
+
+	if cmd.reviews.value != nil {
+		if *cmd.reviews.value < 0 || *cmd.reviews.value > 6 {
+			return errors.New("reviews must be between 0 and 6")
+		}
+		if *cmd.reviews.value == 0 && (isTrue(cmd.dismissStale.value) || isTrue(cmd.codeOwners.value)) {
+			return errors.New("--dismiss-stale-reviews and --code-owner-reviews can not be enabled with --reviews 0")
+		}
+	}
+
+	if len(cmd.from) > 0 {
+		var err error
+		cmd.fromProtection, err = getReferenceProtection(ctx, cmd.from)
+		if err != nil {
+			return err
+		}
+	}
+
+	return runCommand(ctx, cmd.handleRepoProtectBranch)
 }
 
 // handleRepo will return nil error if the user does not have access to something.
-func handleRepoProtectBranch(ctx context.Context, client *github.Client, repo *github.Repository) error {
-	opt := &github.ListOptions{
-		PerPage: 100,
+func (cmd *protectCommand) handleRepoProtectBranch(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	branches, resp, err := listBranches(ctx, client, repo)
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, branch := range branches {
+		if !cmd.matchBranch(repo, branch.GetName()) {
+			continue
+		}
+
+		if cmd.remove {
+			err = unprotectBranch(ctx, client, repo, branch.GetName())
+		} else {
+			err = cmd.protectBranch(ctx, client, repo, branch.GetName())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matchBranch returns true if the branch was selected by the branch names or
+// patterns passed on the command line. If neither were passed then only the
+// repository's default branch is selected.
+func (cmd *protectCommand) matchBranch(repo *github.Repository, name string) bool {
+	if len(cmd.branches) < 1 && len(cmd.patterns) < 1 {
+		return name == repo.GetDefaultBranch()
+	}
+
+	if in(cmd.branches, name) {
+		return true
+	}
+
+	for _, p := range cmd.patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cmd *protectCommand) protectBranch(ctx context.Context, client *github.Client, repo *github.Repository, branch string) error {
+	// we must get the individual branch for the branch protection to work
+	b, _, err := client.Repositories.GetBranch(ctx, repo.GetOwner().GetLogin(), repo.GetName(), branch)
+	if err != nil {
+		return err
+	}
+
+	// get the existing protection so we can compare it to what we want
+	var current, want *github.ProtectionRequest
+	if b.GetProtected() {
+		p, _, err := client.Repositories.GetBranchProtection(ctx, repo.GetOwner().GetLogin(), repo.GetName(), b.GetName())
+		if err != nil {
+			return err
+		}
+		current = protectionRequestFrom(p)
+		// a separate copy the flags are applied to
+		want = protectionRequestFrom(p)
+	}
+
+	if cmd.fromProtection != nil {
+		want = cmd.fromProtection
+	} else {
+		want = cmd.protectionRequest(want)
+	}
+
+	changes := diffProtection(current, want)
+	if len(changes) < 1 {
+		fmt.Printf("[OK] %s:%s is already protected\n", repo.GetFullName(), b.GetName())
+		return nil
 	}
 
-	branches, resp, err := client.Repositories.ListBranches(ctx, *repo.Owner.Login, *repo.Name, opt)
-	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden {
+	if dryrun {
+		if current == nil {
+			fmt.Printf("[UPDATE] %s:%s will be changed to protected\n", repo.GetFullName(), b.GetName())
+		} else {
+			fmt.Printf("[UPDATE] %s:%s protection will be changed\n", repo.GetFullName(), b.GetName())
+		}
+		printProtectionChanges(changes)
 		return nil
 	}
+
+	if err := updateProtection(ctx, client, repo, b.GetName(), current, want, changes); err != nil {
+		return err
+	}
+	fmt.Printf("[OK] %s:%s is protected\n", repo.GetFullName(), b.GetName())
+	printProtectionChanges(changes)
+
+	return nil
+}
+
+func unprotectBranch(ctx context.Context, client *github.Client, repo *github.Repository, branch string) error {
+	// we must get the individual branch for the branch protection to work
+	b, _, err := client.Repositories.GetBranch(ctx, repo.GetOwner().GetLogin(), repo.GetName(), branch)
 	if err != nil {
 		return err
 	}
 
-	for _, branch := range branches {
-		if branch.GetName() == "master" {
-			// we must get the individual branch for the branch protection to work
-			b, _, err := client.Repositories.GetBranch(ctx, *repo.Owner.Login, *repo.Name, branch.GetName())
-			if err != nil {
+	// return early if there is nothing to remove
+	if !b.GetProtected() {
+		fmt.Printf("[OK] %s:%s is not protected\n", repo.GetFullName(), b.GetName())
+		return nil
+	}
+
+	p, _, err := client.Repositories.GetBranchProtection(ctx, repo.GetOwner().GetLogin(), repo.GetName(), b.GetName())
+	if err != nil {
+		return err
+	}
+	// diff against an empty protection to report the settings being removed
+	changes := diffProtection(protectionRequestFrom(p), &github.ProtectionRequest{})
+
+	if dryrun {
+		fmt.Printf("[UPDATE] %s:%s protection will be removed\n", repo.GetFullName(), b.GetName())
+		printProtectionChanges(changes)
+		return nil
+	}
+
+	if _, err := client.Repositories.RemoveBranchProtection(ctx, repo.GetOwner().GetLogin(), repo.GetName(), b.GetName()); err != nil {
+		return err
+	}
+	fmt.Printf("[OK] %s:%s protection removed\n", repo.GetFullName(), b.GetName())
+	printProtectionChanges(changes)
+
+	return nil
+}
+
+// updateProtection applies the changes to the branch protection. Fields that
+// can be patched individually are, everything else falls back to replacing
+// the whole protection.
+func updateProtection(ctx context.Context, client *github.Client, repo *github.Repository, branch string, current, want *github.ProtectionRequest, changes []protectionChange) error {
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+
+	if needsFullProtectionUpdate(current, want, changes) {
+		_, _, err := client.Repositories.UpdateBranchProtection(ctx, owner, name, branch, want)
+		return err
+	}
+
+	sections := map[string]bool{}
+	for _, c := range changes {
+		sections[c.section()] = true
+	}
+
+	if sections["required_status_checks"] {
+		if _, _, err := client.Repositories.UpdateRequiredStatusChecks(ctx, owner, name, branch, &github.RequiredStatusChecksRequest{
+			Strict:   &want.RequiredStatusChecks.Strict,
+			Contexts: want.RequiredStatusChecks.Contexts,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if sections["required_pull_request_reviews"] {
+		reviews := want.RequiredPullRequestReviews
+		if _, _, err := client.Repositories.UpdatePullRequestReviewEnforcement(ctx, owner, name, branch, &github.PullRequestReviewsEnforcementUpdate{
+			DismissalRestrictionsRequest: reviews.DismissalRestrictionsRequest,
+			DismissStaleReviews:          &reviews.DismissStaleReviews,
+			RequireCodeOwnerReviews:      reviews.RequireCodeOwnerReviews,
+			RequiredApprovingReviewCount: reviews.RequiredApprovingReviewCount,
+		}); err != nil {
+			return err
+		}
+		if reviews.DismissalRestrictionsRequest == nil && current.RequiredPullRequestReviews.DismissalRestrictionsRequest != nil {
+			if _, _, err := client.Repositories.DisableDismissalRestrictions(ctx, owner, name, branch); err != nil {
 				return err
 			}
+		}
+	}
 
-			// return early if it is already protected
-			if b.GetProtected() {
-				fmt.Printf("[OK] %s:%s is already protected\n", *repo.FullName, b.GetName())
-				return nil
-			}
+	if sections["enforce_admins"] {
+		var err error
+		if want.EnforceAdmins {
+			_, _, err = client.Repositories.AddAdminEnforcement(ctx, owner, name, branch)
+		} else {
+			_, err = client.Repositories.RemoveAdminEnforcement(ctx, owner, name, branch)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// needsFullProtectionUpdate returns true if the changes cannot be applied with
+// the individual protection endpoints. That is the case when the branch is not
+// protected yet, a whole section is added or removed, the restrictions change,
+// or a value needs to be cleared that the patch requests would omit.
+func needsFullProtectionUpdate(current, want *github.ProtectionRequest, changes []protectionChange) bool {
+	if current == nil {
+		return true
+	}
 
-			if dryrun {
-				fmt.Printf("[UPDATE] %s:%s will be changed to protected\n", *repo.FullName, b.GetName())
-				return nil
+	for _, c := range changes {
+		switch c.field {
+		case "required_status_checks", "required_pull_request_reviews", "restrictions", "restrictions.users", "restrictions.teams":
+			return true
+		case "required_status_checks.contexts":
+			if len(want.RequiredStatusChecks.Contexts) < 1 {
+				return true
 			}
+		case "required_pull_request_reviews.require_code_owner_reviews":
+			if !want.RequiredPullRequestReviews.RequireCodeOwnerReviews {
+				return true
+			}
+		}
+	}
 
-			// set the branch to be protected
-			if _, _, err := client.Repositories.UpdateBranchProtection(ctx, *repo.Owner.Login, *repo.Name, b.GetName(), &github.ProtectionRequest{
-				RequiredStatusChecks: &github.RequiredStatusChecks{
-					Strict:   false,
-					Contexts: []string{},
-				},
-			}); err != nil {
-				return err
+	return false
+}
+
+// protectionRequest applies the protection flags that were passed to the
+// existing protection of a branch and returns it. A nil protection means the
+// branch is not protected yet, it then only requires the status checks like
+// pepper always did. Settings whose flags were not passed are left as they
+// are.
+func (cmd *protectCommand) protectionRequest(preq *github.ProtectionRequest) *github.ProtectionRequest {
+	if preq == nil {
+		preq = &github.ProtectionRequest{
+			RequiredStatusChecks: &github.RequiredStatusChecks{
+				Strict:   false,
+				Contexts: []string{},
+			},
+		}
+	}
+
+	if cmd.strict.value != nil || len(cmd.contexts) > 0 {
+		if preq.RequiredStatusChecks == nil {
+			preq.RequiredStatusChecks = &github.RequiredStatusChecks{Contexts: []string{}}
+		}
+		if cmd.strict.value != nil {
+			preq.RequiredStatusChecks.Strict = *cmd.strict.value
+		}
+		if len(cmd.contexts) > 0 {
+			preq.RequiredStatusChecks.Contexts = sorted(cmd.contexts)
+		}
+	}
+
+	if cmd.reviews.value != nil && *cmd.reviews.value == 0 {
+		preq.RequiredPullRequestReviews = nil
+	} else if cmd.reviews.value != nil || isTrue(cmd.dismissStale.value) || isTrue(cmd.codeOwners.value) || preq.RequiredPullRequestReviews != nil {
+		if preq.RequiredPullRequestReviews == nil {
+			preq.RequiredPullRequestReviews = &github.PullRequestReviewsEnforcementRequest{RequiredApprovingReviewCount: 1}
+		}
+		if cmd.reviews.value != nil {
+			preq.RequiredPullRequestReviews.RequiredApprovingReviewCount = *cmd.reviews.value
+		}
+		if cmd.dismissStale.value != nil {
+			preq.RequiredPullRequestReviews.DismissStaleReviews = *cmd.dismissStale.value
+		}
+		if cmd.codeOwners.value != nil {
+			preq.RequiredPullRequestReviews.RequireCodeOwnerReviews = *cmd.codeOwners.value
+		}
+	}
+
+	if cmd.enforceAdmins.value != nil {
+		preq.EnforceAdmins = *cmd.enforceAdmins.value
+	}
+
+	return preq
+}
+
+// isTrue returns true if the optional boolean was passed and is true.
+func isTrue(b *bool) bool {
+	return b != nil && *b
+}
+
+// getReferenceProtection returns the protection of the reference repository
+// branch formatted as 'owner/repo[:branch]'. The repository's default branch
+// is used if no branch is given.
+func getReferenceProtection(ctx context.Context, from string) (*github.ProtectionRequest, error) {
+	ref, branch := from, ""
+	if i := strings.Index(from, ":"); i >= 0 {
+		ref, branch = from[:i], from[i+1:]
+	}
+	s := strings.SplitN(ref, "/", 2)
+	if len(s) != 2 || len(s[0]) < 1 || len(s[1]) < 1 {
+		return nil, fmt.Errorf("reference repository %q must be in the format 'owner/repo[:branch]'", from)
+	}
+	owner, name := s[0], s[1]
+
+	client, err := newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(branch) < 1 {
+		repo, _, err := client.Repositories.Get(ctx, owner, name)
+		if err != nil {
+			return nil, fmt.Errorf("getting reference repository %s/%s failed: %v", owner, name, err)
+		}
+		branch = repo.GetDefaultBranch()
+	}
+
+	p, resp, err := client.Repositories.GetBranchProtection(ctx, owner, name, branch)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("reference branch %s/%s:%s is not protected or does not exist", owner, name, branch)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting protection for reference branch %s/%s:%s failed: %v", owner, name, branch, err)
+	}
+
+	return protectionRequestFrom(p), nil
+}
+
+// listBranches returns all the branches for a repository, following the
+// pagination until the last page.
+func listBranches(ctx context.Context, client *github.Client, repo *github.Repository) ([]*github.Branch, *github.Response, error) {
+	opt := &github.ListOptions{
+		Page:    1,
+		PerPage: 100,
+	}
+
+	all := []*github.Branch{}
+	for {
+		branches, resp, err := client.Repositories.ListBranches(ctx, repo.GetOwner().GetLogin(), repo.GetName(), opt)
+		if err != nil {
+			return nil, resp, err
+		}
+		all = append(all, branches...)
+
+		// Return if we are on the last page.
+		if resp.NextPage == 0 {
+			return all, resp, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// protectionChange is a single field that differs between the existing and
+// the wanted branch protection.
+type protectionChange struct {
+	field string
+	from  string
+	to    string
+}
+
+// section returns the top level protection setting the field belongs to.
+func (c protectionChange) section() string {
+	return strings.SplitN(c.field, ".", 2)[0]
+}
+
+func (c protectionChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.field, c.from, c.to)
+}
+
+func printProtectionChanges(changes []protectionChange) {
+	for _, c := range changes {
+		fmt.Printf("\t%s\n", c)
+	}
+}
+
+// diffProtection compares the existing protection of a branch with the wanted
+// one and returns the fields that differ. A nil current protection means the
+// branch is not protected.
+func diffProtection(current, want *github.ProtectionRequest) []protectionChange {
+	if current == nil {
+		current = &github.ProtectionRequest{}
+	}
+
+	changes := []protectionChange{}
+	add := func(field string, from, to interface{}) {
+		f, t := fmt.Sprint(from), fmt.Sprint(to)
+		if f != t {
+			changes = append(changes, protectionChange{field: field, from: f, to: t})
+		}
+	}
+
+	// Required status checks.
+	add("required_status_checks", enabled(current.RequiredStatusChecks != nil), enabled(want.RequiredStatusChecks != nil))
+	if want.RequiredStatusChecks != nil {
+		cur := current.RequiredStatusChecks
+		if cur == nil {
+			cur = &github.RequiredStatusChecks{}
+		}
+		add("required_status_checks.strict", cur.Strict, want.RequiredStatusChecks.Strict)
+		add("required_status_checks.contexts", sorted(cur.Contexts), sorted(want.RequiredStatusChecks.Contexts))
+	}
+
+	// Required pull request reviews.
+	add("required_pull_request_reviews", enabled(current.RequiredPullRequestReviews != nil), enabled(want.RequiredPullRequestReviews != nil))
+	if want.RequiredPullRequestReviews != nil {
+		cur := current.RequiredPullRequestReviews
+		if cur == nil {
+			cur = &github.PullRequestReviewsEnforcementRequest{}
+		}
+		add("required_pull_request_reviews.required_approving_review_count", cur.RequiredApprovingReviewCount, want.RequiredPullRequestReviews.RequiredApprovingReviewCount)
+		add("required_pull_request_reviews.dismiss_stale_reviews", cur.DismissStaleReviews, want.RequiredPullRequestReviews.DismissStaleReviews)
+		add("required_pull_request_reviews.require_code_owner_reviews", cur.RequireCodeOwnerReviews, want.RequiredPullRequestReviews.RequireCodeOwnerReviews)
+
+		curUsers, curTeams := dismissalRestrictions(cur.DismissalRestrictionsRequest)
+		wantUsers, wantTeams := dismissalRestrictions(want.RequiredPullRequestReviews.DismissalRestrictionsRequest)
+		add("required_pull_request_reviews.dismissal_restrictions.users", curUsers, wantUsers)
+		add("required_pull_request_reviews.dismissal_restrictions.teams", curTeams, wantTeams)
+	}
+
+	// Enforce for administrators.
+	add("enforce_admins", current.EnforceAdmins, want.EnforceAdmins)
+
+	// Push restrictions.
+	add("restrictions", enabled(current.Restrictions != nil), enabled(want.Restrictions != nil))
+	if want.Restrictions != nil {
+		cur := current.Restrictions
+		if cur == nil {
+			cur = &github.BranchRestrictionsRequest{}
+		}
+		add("restrictions.users", sorted(cur.Users), sorted(want.Restrictions.Users))
+		add("restrictions.teams", sorted(cur.Teams), sorted(want.Restrictions.Teams))
+	}
+
+	return changes
+}
+
+// protectionRequestFrom converts the protection returned by the API into the
+// request structure so it can be compared with, or sent as, a wanted
+// protection.
+func protectionRequestFrom(p *github.Protection) *github.ProtectionRequest {
+	preq := &github.ProtectionRequest{}
+
+	if p.RequiredStatusChecks != nil {
+		preq.RequiredStatusChecks = &github.RequiredStatusChecks{
+			Strict:   p.RequiredStatusChecks.Strict,
+			Contexts: sorted(p.RequiredStatusChecks.Contexts),
+		}
+	}
+
+	if p.RequiredPullRequestReviews != nil {
+		reviews := p.RequiredPullRequestReviews
+		preq.RequiredPullRequestReviews = &github.PullRequestReviewsEnforcementRequest{
+			DismissStaleReviews:          reviews.DismissStaleReviews,
+			RequireCodeOwnerReviews:      reviews.RequireCodeOwnerReviews,
+			RequiredApprovingReviewCount: reviews.RequiredApprovingReviewCount,
+		}
+		if len(reviews.DismissalRestrictions.Users) > 0 || len(reviews.DismissalRestrictions.Teams) > 0 {
+			users, teams := userLogins(reviews.DismissalRestrictions.Users), teamSlugs(reviews.DismissalRestrictions.Teams)
+			preq.RequiredPullRequestReviews.DismissalRestrictionsRequest = &github.DismissalRestrictionsRequest{
+				Users: &users,
+				Teams: &teams,
 			}
-			fmt.Printf("[OK] %s:%s is protected\n", *repo.FullName, b.GetName())
 		}
 	}
 
-	return nil
+	if p.EnforceAdmins != nil {
+		preq.EnforceAdmins = p.EnforceAdmins.Enabled
+	}
+
+	if p.Restrictions != nil {
+		preq.Restrictions = &github.BranchRestrictionsRequest{
+			Users: userLogins(p.Restrictions.Users),
+			Teams: teamSlugs(p.Restrictions.Teams),
+		}
+	}
+
+	return preq
+}
+
+func dismissalRestrictions(r *github.DismissalRestrictionsRequest) ([]string, []string) {
+	if r == nil {
+		return []string{}, []string{}
+	}
+
+	users, teams := []string{}, []string{}
+	if r.Users != nil {
+		users = sorted(*r.Users)
+	}
+	if r.Teams != nil {
+		teams = sorted(*r.Teams)
+	}
+	return users, teams
+}
+
+func userLogins(users []*github.User) []string {
+	s := []string{}
+	for _, u := range users {
+		s = append(s, u.GetLogin())
+	}
+	return sorted(s)
+}
+
+func teamSlugs(teams []*github.Team) []string {
+	s := []string{}
+	for _, t := range teams {
+		s = append(s, t.GetSlug())
+	}
+	return sorted(s)
+}
+
+// sorted returns a sorted copy of the slice, it never returns nil so the
+// result can be sent to the API as an empty list.
+func sorted(a []string) []string {
+	s := append([]string{}, a...)
+	sort.Strings(s)
+	return s
+}
+
+func enabled(b bool) string {
+	if b {
+		return "enabled"
+	}
+	return "disabled"
 }
@@ -3,28 +3,112 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
-	"html/template"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
 	"strings"
+	"text/template"
 
 	"github.com/google/go-github/github"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+	yaml "gopkg.in/yaml.v2"
 )
 
 const (
 	releaseHelp = `Update the release body information.`
 
+	releaseLongHelp = `Update the release body information.
+
+Actions:
+
+  verify                download the binaries and compare them with the
+                        published checksums and, with --keyring, check their
+                        signatures
+  checksums             upload the missing .sha256, and with --sha512 .sha512,
+                        checksums of the binaries and update the release body
+  create                create a draft of the --tag release in the --repo
+                        repository, or update the existing draft, upload the
+                        binaries in --dir with their checksums and signatures,
+                        publish it and render the release body
+
+Without an action the release body is updated. The body is rendered from the
+template passed with --template, or else from .github/release-template.md in
+the repository, or else from the built-in template with install instructions.
+Templates use << and >> as delimiters and get the following data:
+
+  .Repository           the repository (e.g. << .Repository.FullName >>)
+  .Release              the release (e.g. << .Release.TagName >>)
+  .PreviousTag          the tag of the release before this one, if any,
+                        skipping drafts and prereleases
+  .Assets               the binaries by OS and architecture, each with
+                        .BinaryName, .BinaryURL, .BinarySHA256,
+                        .BinarySHA512, .BinaryMD5, .OS, .Arch, .Version,
+                        .Ext and the .SignatureName, .SignatureURL and
+                        .Signer of the .asc or .sig signature
+  .Checksums            the SHA256 checksums by binary name
+
+Besides the built-in functions the templates can use ToUpper, ToLower, Title,
+Replace, TrimPrefix, TrimSuffix, HasPrefix, HasSuffix, Contains and Join.
+
+With --changelog the pull requests merged and the commits pushed since the
+previous release are prepended, grouped in sections by their labels. The
+sections default to Features (feature, enhancement) and Bug Fixes (bug, bugfix,
+fix), other ones can be passed with --changelog-sections:
+
+  - title: Breaking Changes
+    labels: [breaking]
+  - title: Features
+    labels: [feature]
+
+The changes without any of the labels are listed under Other Changes.
+
+The rendered text is placed between <!-- pepper:begin --> and
+<!-- pepper:end --> in the release body, or appended to it if the markers are
+missing, everything outside the markers is kept as is.
+
+The OS, architecture, version and extension of the binaries are parsed from
+the asset names with --asset-pattern, either one of the presets:
+
+  default               {repo}-linux-amd64, {repo}-windows-amd64.exe
+  goreleaser            {repo}_1.2.3_linux_amd64.tar.gz
+  gox                   {repo}_linux_amd64, {repo}_windows_amd64.exe
+
+or a regular expression with the os and arch named groups and optionally the
+version and ext ones, {repo} is replaced by the name of the repository. The
+checksums are read from the assets with the same name and .sha256, .sha512 or
+.md5 appended, and from aggregate files like SHA256SUMS or checksums.txt.`
+
+	releaseTemplatePath = ".github/release-template.md"
+
+	// The generated part of the release body is kept between these markers,
+	// the rest of the body is left untouched.
+	releaseBegin = "<!-- pepper:begin -->"
+	releaseEnd   = "<!-- pepper:end -->"
+
 	releaseTmpl = `Below are easy install instructions by OS and Architecture. As always there are always the standard instructions in the [README.md](README.md) as well.
 
-<< range $os, $v := . >>
+<< range $os, $v := .Assets >>
 #### << $os  >>
 
 << range $arch, $r := $v >>
+<<- /* Raw binaries are installed as is, tarballs are extracted and the
+other assets like zip files and .exe binaries are only downloaded. */ ->>
+<<- $file := printf "/usr/local/bin/%s" $r.Repository.GetName >>
+<<- if eq $r.Ext ".tar.gz" >><< $file = printf "/tmp/%s" $r.BinaryName >>
+<<- else if $r.Ext >><< $file = $r.BinaryName >>
+<<- end >>
 ##### << $arch >> - << $os >>
 
 ` + "```" + `console
@@ -32,47 +116,162 @@ const (
 $ export << $r.Repository.Name | ToUpper >>_SHA256="<< $r.BinarySHA256 >>"
 
 # Download and check the sha256sum.
-$ curl -fSL "<< $r.BinaryURL >>" -o "/usr/local/bin/<< $r.Repository.Name >>" \
-	&& echo "` + "${" + `<< $r.Repository.Name | ToUpper >>_SHA256` + "}" + `  /usr/local/bin/<< $r.Repository.Name >>" | sha256sum -c - \
-	&& chmod a+x "/usr/local/bin/<< $r.Repository.Name >>"
+$ curl -fSL "<< $r.BinaryURL >>" -o "<< $file >>" \
+	&& echo "` + "${" + `<< $r.Repository.Name | ToUpper >>_SHA256` + "}" + `  << $file >>" | sha256sum -c -
+<<- if not $r.Ext >> \
+	&& chmod a+x "<< $file >>"
+<<- else if eq $r.Ext ".tar.gz" >> \
+	&& tar -C /usr/local/bin -xzf "<< $file >>" "<< $r.Repository.Name >>"
+<<- end >>
+<<- if $r.SignatureURL >>
+
+# Verify the signature<< if $r.Signer >> made by << $r.Signer >><< end >>.
+$ curl -fSL "<< $r.SignatureURL >>" -o "/tmp/<< $r.SignatureName >>" \
+	&& gpg --verify "/tmp/<< $r.SignatureName >>" "<< $file >>"
+<<- end >>
+<<- if or (not $r.Ext) (eq $r.Ext ".tar.gz") >>
 
 $ echo "<< $r.Repository.Name >> installed!"
 
 # Run it!
 $ << $r.Repository.Name >> -h
+<<- end >>
 ` + "```" + `
 <<end>>
 <<end>>
 `
 )
 
+// assetPatterns are the presets for --asset-pattern, for the names of the
+// binaries built by the common release tools.
+var assetPatterns = map[string]string{
+	"default":    `^{repo}-(?P<os>[^-.]+)-(?P<arch>[^.]+)(?P<ext>\.exe)?$`,
+	"goreleaser": `^{repo}_(?P<version>[^_]+)_(?P<os>[^_]+)_(?P<arch>[^.]+)(?P<ext>\.tar\.gz|\.zip|\.exe)?$`,
+	"gox":        `^{repo}_(?P<os>[^_]+)_(?P<arch>[^.]+)(?P<ext>\.exe)?$`,
+}
+
 func (cmd *releaseCommand) Name() string      { return "release" }
-func (cmd *releaseCommand) Args() string      { return "[OPTIONS]" }
+func (cmd *releaseCommand) Args() string      { return "[OPTIONS] [ACTION]" }
 func (cmd *releaseCommand) ShortHelp() string { return releaseHelp }
-func (cmd *releaseCommand) LongHelp() string  { return releaseHelp }
+func (cmd *releaseCommand) LongHelp() string  { return releaseLongHelp }
 func (cmd *releaseCommand) Hidden() bool      { return false }
 
 func (cmd *releaseCommand) Register(fs *flag.FlagSet) {
-	fs.BoolVar(&cmd.all, "all", false, "Update all the releases, not just the latest")
+	fs.BoolVar(&cmd.all, "all", false, "Handle all the releases, not just the latest")
+	fs.StringVar(&cmd.templateFile, "template", "", "file containing the template for the release body, overrides the template in the repository")
+	fs.StringVar(&cmd.keyringFile, "keyring", "", "file containing the public keys to check the signatures of the assets against")
+	fs.BoolVar(&cmd.sha512, "sha512", false, "Also upload the missing SHA512 checksums")
+	fs.BoolVar(&cmd.changelog, "changelog", false, "Prepend the pull requests and commits since the previous release to the release body")
+	fs.StringVar(&cmd.sectionsFile, "changelog-sections", "", "YAML file containing the sections of the changelog and their labels")
+	fs.StringVar(&cmd.tag, "tag", "", "tag of the release to create")
+	fs.StringVar(&cmd.dir, "dir", "", "directory containing the assets of the release to create")
+	fs.BoolVar(&cmd.draft, "draft", false, "Leave the created release as a draft instead of publishing it")
+	fs.StringVar(&cmd.assetPattern, "asset-pattern", "default", "preset (default, goreleaser or gox) or regular expression with the os, arch, version and ext named groups to parse the asset names")
 }
 
 type releaseCommand struct {
-	all bool
+	all          bool
+	templateFile string
+	assetPattern string
+	keyringFile  string
+	sha512       bool
+	changelog    bool
+	sectionsFile string
+	tag          string
+	dir          string
+	draft        bool
+
+	action   string
+	tmpl     *template.Template
+	keyring  openpgp.EntityList
+	sections []changelogSection
+	// failed counts the assets that failed verification.
+	failed int
 }
 
 func (cmd *releaseCommand) Run(ctx context.Context, args []string) error {
-	return runCommand(ctx, cmd.handleRelease)
+	if len(args) > 0 {
+		cmd.action = args[0]
+	}
+	switch cmd.action {
+	case "", "verify", "checksums":
+	case "create":
+		if len(cmd.tag) < 1 || len(cmd.dir) < 1 {
+			return errors.New("must pass the tag of the release with --tag and the directory of the assets with --dir to create")
+		}
+		if len(singleRepo) < 1 {
+			return errors.New("must pass the repository to create the release in with --repo")
+		}
+	default:
+		return fmt.Errorf("unknown action %q, must be verify, checksums, create or none to update the release body", cmd.action)
+	}
+
+	if p, ok := assetPatterns[cmd.assetPattern]; ok {
+		cmd.assetPattern = p
+	}
+	if _, err := assetRegexp(cmd.assetPattern, "repo"); err != nil {
+		return err
+	}
+
+	if len(cmd.keyringFile) > 0 {
+		var err error
+		cmd.keyring, err = readKeyring(cmd.keyringFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	cmd.sections = defaultChangelogSections
+	if len(cmd.sectionsFile) > 0 {
+		b, err := ioutil.ReadFile(cmd.sectionsFile)
+		if err != nil {
+			return fmt.Errorf("reading changelog sections file %s failed: %v", cmd.sectionsFile, err)
+		}
+		cmd.sections = nil
+		if err := yaml.UnmarshalStrict(b, &cmd.sections); err != nil {
+			return fmt.Errorf("parsing changelog sections file %s failed: %v", cmd.sectionsFile, err)
+		}
+		for i, section := range cmd.sections {
+			if len(section.Title) < 1 {
+				return fmt.Errorf("section %d in %s has no title", i+1, cmd.sectionsFile)
+			}
+		}
+	}
+
+	if len(cmd.templateFile) > 0 {
+		b, err := ioutil.ReadFile(cmd.templateFile)
+		if err != nil {
+			return fmt.Errorf("reading template file %s failed: %v", cmd.templateFile, err)
+		}
+		cmd.tmpl, err = parseReleaseTemplate(string(b))
+		if err != nil {
+			return fmt.Errorf("parsing template file %s failed: %v", cmd.templateFile, err)
+		}
+	}
+
+	if err := runCommand(ctx, cmd.handleRelease); err != nil {
+		return err
+	}
+
+	if cmd.failed > 0 {
+		return fmt.Errorf("%d release assets failed verification", cmd.failed)
+	}
+	return nil
 }
 
 // handleRelease will return nil error if the user does not have access to something.
 func (cmd *releaseCommand) handleRelease(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	if cmd.action == "create" {
+		return cmd.createRelease(ctx, client, repo)
+	}
+
 	opt := &github.ListOptions{
 		Page:    1,
 		PerPage: 100,
 	}
 
 	releases, resp, err := client.Repositories.ListReleases(ctx, repo.GetOwner().GetLogin(), repo.GetName(), opt)
-	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden || err != nil {
+	if resp == nil || resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden || err != nil {
 		if _, ok := err.(*github.RateLimitError); ok {
 			return err
 		}
@@ -84,79 +283,62 @@ func (cmd *releaseCommand) handleRelease(ctx context.Context, client *github.Cli
 		return err
 	}
 
-	// Get information about the binary assets.
-	for _, r := range releases {
-		// This holds data like os -> arch -> release and we will use it for rendering our
-		// release body template.
-		allReleases := map[string]map[string]release{}
-
-		// Iterate over the assets.
-		for _, asset := range r.Assets {
-			if !strings.Contains(asset.GetName(), ".") {
-				// We know we are on a binary and not a hashsum.
-				suffix := strings.SplitN(strings.TrimPrefix(asset.GetName(), repo.GetName()+"-"), "-", 2)
-				if len(suffix) == 2 {
-					// Add this to our overall releases map.
-					osn := suffix[0]
-					arch := suffix[1]
-
-					// Prefill the map to avoid a panic.
-					if _, ok := allReleases[osn]; !ok {
-						allReleases[osn] = map[string]release{}
-					}
-
-					tr, ok := allReleases[osn][arch]
-					if !ok {
-						allReleases[osn][arch] = release{
-							BinaryURL:  asset.GetBrowserDownloadURL(),
-							BinaryName: asset.GetName(),
-							Repository: repo,
-						}
-					} else {
-						tr.BinaryURL = asset.GetBrowserDownloadURL()
-						tr.BinaryName = asset.GetName()
-						allReleases[osn][arch] = tr
-					}
-				}
+	re, err := assetRegexp(cmd.assetPattern, repo.GetName())
+	if err != nil {
+		return err
+	}
+
+	if cmd.action == "verify" {
+		for _, r := range releases {
+			if err := cmd.verifyRelease(ctx, client, repo, r, re); err != nil {
+				return err
 			}
 
-			if strings.HasSuffix(asset.GetName(), ".sha256") {
-				// We know we are on a sha256sum.
-				suffix := strings.SplitN(strings.TrimSuffix(strings.TrimPrefix(asset.GetName(), repo.GetName()+"-"), ".sha256"), "-", 2)
-				if len(suffix) == 2 {
-					// Add this to our overall releases map.
-					osn := suffix[0]
-					arch := suffix[1]
-
-					c, err := getReleaseAssetContent(ctx, client, repo, asset.GetID())
-					if err != nil {
-						return err
-					}
-
-					// Prefill the map to avoid a panic.
-					if _, ok := allReleases[osn]; !ok {
-						allReleases[osn] = map[string]release{}
-					}
-
-					tr, ok := allReleases[osn][arch]
-					if !ok {
-						allReleases[osn][arch] = release{
-							BinarySHA256: c,
-							Repository:   repo,
-						}
-					} else {
-						tr.BinarySHA256 = c
-						allReleases[osn][arch] = tr
-					}
-				}
+			// We verified the latest release, stop.
+			if !cmd.all {
+				break
 			}
 		}
+		return nil
+	}
 
-		if err := updateRelease(ctx, client, repo, r, allReleases); err != nil {
-			return err
+	t, err := cmd.releaseTemplate(ctx, client, repo)
+	if err != nil {
+		return err
+	}
+
+	// Get information about the binary assets.
+	for i, r := range releases {
+		previous := previousRelease(releases[i+1:])
+
+		render := true
+		if cmd.action == "checksums" {
+			missing, err := cmd.addReleaseChecksums(ctx, client, repo, r, re)
+			if err != nil {
+				return err
+			}
+			switch {
+			case !missing:
+				fmt.Printf("[OK] %s %s has all its checksums\n", repo.GetFullName(), r.GetTagName())
+			case dryrun:
+				// The body can not be rendered with the checksums that were
+				// not uploaded.
+				render = false
+				fmt.Printf("[UPDATE] %s release %s body will be rendered with the new checksums\n", repo.GetFullName(), r.GetTagName())
+			default:
+				// Get the release again for the uploaded assets.
+				r, _, err = client.Repositories.GetRelease(ctx, repo.GetOwner().GetLogin(), repo.GetName(), r.GetID())
+				if err != nil {
+					return err
+				}
+			}
 		}
 
-		fmt.Printf("Updated release %s/%s for repo: %s\n", r.GetName(), r.GetTagName(), repo.GetFullName())
+		if render {
+			if err := cmd.renderRelease(ctx, client, repo, r, t, re, previous); err != nil {
+				return err
+			}
+		}
 
 		// We updated the latest release, stop.
 		if !cmd.all {
@@ -167,60 +349,552 @@ func (cmd *releaseCommand) handleRelease(ctx context.Context, client *github.Cli
 	return nil
 }
 
+// previousRelease returns the tag of the newest published release that is not
+// a prerelease, the releases are sorted from the newest to the oldest. Drafts
+// are skipped because their tag might not exist yet.
+func previousRelease(releases []*github.RepositoryRelease) string {
+	for _, r := range releases {
+		if !r.GetDraft() && !r.GetPrerelease() {
+			return r.GetTagName()
+		}
+	}
+	return ""
+}
+
+// renderRelease renders the body of the release, with the changelog since the
+// previous release if asked for, and updates the release if it changed.
+func (cmd *releaseCommand) renderRelease(ctx context.Context, client *github.Client, repo *github.Repository, r *github.RepositoryRelease, t *template.Template, re *regexp.Regexp, previous string) error {
+	data, err := newReleaseData(ctx, client, repo, r, re, cmd.keyring, previous)
+	if err != nil {
+		return err
+	}
+
+	if cmd.changelog {
+		if len(previous) > 0 {
+			// The tag of a draft is only created when it is published.
+			head := r.GetTagName()
+			if r.GetDraft() {
+				head = r.GetTargetCommitish()
+				if len(head) < 1 {
+					head = repo.GetDefaultBranch()
+				}
+			}
+			entries, err := getChangelog(ctx, client, repo, previous, head)
+			if err != nil {
+				return err
+			}
+			data.changelog = formatChangelog(previous, entries, cmd.sections)
+		} else {
+			logrus.Debugf("Skipping the changelog of %s %s, there is no previous release", repo.GetFullName(), r.GetTagName())
+		}
+	}
+
+	return updateRelease(ctx, client, repo, r, t, data)
+}
+
+// newReleaseData returns the data to render the release body template with.
+func newReleaseData(ctx context.Context, client *github.Client, repo *github.Repository, r *github.RepositoryRelease, re *regexp.Regexp, keyring openpgp.EntityList, previous string) (releaseData, error) {
+	// This holds data like os -> arch -> release and we will use it for rendering our
+	// release body template.
+	allReleases, err := collectReleaseAssets(ctx, client, repo, r, re, keyring)
+	if err != nil {
+		return releaseData{}, err
+	}
+
+	data := releaseData{
+		Repository:  repo,
+		Release:     r,
+		PreviousTag: previous,
+		Assets:      allReleases,
+		Checksums:   map[string]string{},
+	}
+	for _, v := range allReleases {
+		for _, a := range v {
+			if len(a.BinaryName) > 0 && len(a.BinarySHA256) > 0 {
+				data.Checksums[a.BinaryName] = a.BinarySHA256
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// collectReleaseAssets returns the binaries of the release by OS and
+// architecture for rendering the release body. If more than one binary has
+// the same OS and architecture only the last one is kept.
+func collectReleaseAssets(ctx context.Context, client *github.Client, repo *github.Repository, r *github.RepositoryRelease, re *regexp.Regexp, keyring openpgp.EntityList) (map[string]map[string]release, error) {
+	binaries, err := listReleaseBinaries(ctx, client, repo, r, re, keyring)
+	if err != nil {
+		return nil, err
+	}
+
+	assets := map[string]map[string]release{}
+	for _, b := range binaries {
+		// Prefill the map to avoid a panic.
+		if _, ok := assets[b.OS]; !ok {
+			assets[b.OS] = map[string]release{}
+		}
+
+		if prev, ok := assets[b.OS][b.Arch]; ok {
+			logrus.Warnf("%s %s has both %s and %s for %s/%s, only %s is in the release body", repo.GetFullName(), r.GetTagName(), prev.BinaryName, b.BinaryName, b.OS, b.Arch, b.BinaryName)
+		}
+		assets[b.OS][b.Arch] = b
+	}
+
+	return assets, nil
+}
+
+// listReleaseBinaries returns every asset of the release matching the asset
+// pattern sorted by name, with their checksums from the .sha256, .sha512 and
+// .md5 assets next to them or from the aggregate checksum files like
+// SHA256SUMS, and their .asc or .sig signatures. The signers are looked up in
+// the keyring, which can be nil.
+func listReleaseBinaries(ctx context.Context, client *github.Client, repo *github.Repository, r *github.RepositoryRelease, re *regexp.Regexp, keyring openpgp.EntityList) ([]release, error) {
+	sums, err := getReleaseChecksums(ctx, client, repo, r)
+	if err != nil {
+		return nil, err
+	}
+
+	signatures := map[string]github.ReleaseAsset{}
+	for _, asset := range r.Assets {
+		if isSignatureAsset(asset.GetName()) {
+			signatures[strings.TrimSuffix(asset.GetName(), path.Ext(asset.GetName()))] = asset
+		}
+	}
+
+	binaries := []release{}
+
+	for _, asset := range r.Assets {
+		if isChecksumAsset(asset.GetName()) || isSignatureAsset(asset.GetName()) {
+			continue
+		}
+
+		m := re.FindStringSubmatch(asset.GetName())
+		if m == nil {
+			logrus.Debugf("Skipping asset %s of %s %s, it does not match the asset pattern", asset.GetName(), repo.GetFullName(), r.GetTagName())
+			continue
+		}
+		groups := map[string]string{}
+		for i, n := range re.SubexpNames() {
+			if len(n) > 0 {
+				groups[n] = m[i]
+			}
+		}
+		osn, arch := groups["os"], groups["arch"]
+
+		hashes := sums[asset.GetName()]
+		tr := release{
+			assetID:      asset.GetID(),
+			Repository:   repo,
+			Release:      r,
+			OS:           osn,
+			Arch:         arch,
+			Version:      groups["version"],
+			Ext:          groups["ext"],
+			BinaryName:   asset.GetName(),
+			BinaryURL:    releaseAssetURL(repo, r, asset),
+			BinarySHA256: hashes["sha256"],
+			BinarySHA512: hashes["sha512"],
+			BinaryMD5:    hashes["md5"],
+		}
+
+		if sig, ok := signatures[asset.GetName()]; ok {
+			c, err := getReleaseAssetContent(ctx, client, repo, sig.GetID())
+			if err != nil {
+				return nil, err
+			}
+			tr.signature = []byte(c)
+			tr.SignatureName = sig.GetName()
+			tr.SignatureURL = releaseAssetURL(repo, r, sig)
+			tr.Signer = signer(tr.signature, keyring)
+		}
+
+		binaries = append(binaries, tr)
+	}
+
+	sort.Slice(binaries, func(i, j int) bool {
+		return binaries[i].BinaryName < binaries[j].BinaryName
+	})
+	return binaries, nil
+}
+
+// releaseAssetURL returns the download URL of the asset. The assets of a
+// draft have URLs that break once it is published, so they are built from the
+// tag instead.
+func releaseAssetURL(repo *github.Repository, r *github.RepositoryRelease, asset github.ReleaseAsset) string {
+	if !r.GetDraft() {
+		return asset.GetBrowserDownloadURL()
+	}
+	return fmt.Sprintf("%s/releases/download/%s/%s", repo.GetHTMLURL(), url.PathEscape(r.GetTagName()), url.PathEscape(asset.GetName()))
+}
+
+// checksumSuffixes maps the suffixes of the checksum assets published next to
+// a binary to their hash algorithm.
+var checksumSuffixes = map[string]string{
+	".sha256": "sha256",
+	".sha512": "sha512",
+	".md5":    "md5",
+}
+
+// isChecksumAsset returns true if the asset holds the checksum of a single
+// binary or is an aggregate checksum file.
+func isChecksumAsset(name string) bool {
+	_, ok := checksumSuffixes[path.Ext(name)]
+	return ok || isChecksumsFile(name)
+}
+
+// isChecksumsFile returns true if the asset is an aggregate checksum file like
+// SHA256SUMS, sha512sums.txt or the checksums.txt of goreleaser.
+func isChecksumsFile(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, "sums") || strings.HasSuffix(name, "sums.txt")
+}
+
+// getReleaseChecksums returns the published checksums of the release by asset
+// name and then hash algorithm (sha256, sha512 or md5).
+func getReleaseChecksums(ctx context.Context, client *github.Client, repo *github.Repository, r *github.RepositoryRelease) (map[string]map[string]string, error) {
+	sums := map[string]map[string]string{}
+	add := func(name, algo, sum string) {
+		if _, ok := sums[name]; !ok {
+			sums[name] = map[string]string{}
+		}
+		sums[name][algo] = strings.ToLower(sum)
+	}
+
+	for _, asset := range r.Assets {
+		name := asset.GetName()
+		algo, single := checksumSuffixes[path.Ext(name)]
+		if !single && !isChecksumsFile(name) {
+			continue
+		}
+
+		c, err := getReleaseAssetContent(ctx, client, repo, asset.GetID())
+		if err != nil {
+			return nil, err
+		}
+
+		if single {
+			if fields := strings.Fields(c); len(fields) > 0 {
+				add(strings.TrimSuffix(name, path.Ext(name)), algo, fields[0])
+			}
+			continue
+		}
+
+		for _, l := range parseChecksums(c) {
+			add(l.name, l.algo, l.sum)
+		}
+	}
+
+	return sums, nil
+}
+
+type checksumLine struct {
+	name string
+	algo string
+	sum  string
+}
+
+// parseChecksums parses the output of sha256sum and friends, the algorithm is
+// derived from the length of each checksum.
+func parseChecksums(s string) []checksumLine {
+	lines := []checksumLine{}
+	for _, l := range strings.Split(s, "\n") {
+		fields := strings.Fields(l)
+		if len(fields) != 2 {
+			continue
+		}
+		algo := hashAlgorithm(fields[0])
+		if len(algo) < 1 {
+			continue
+		}
+		lines = append(lines, checksumLine{
+			// A leading '*' marks the file was read in binary mode.
+			name: strings.TrimPrefix(fields[1], "*"),
+			algo: algo,
+			sum:  fields[0],
+		})
+	}
+	return lines
+}
+
+// hashAlgorithm returns the algorithm of the hex encoded checksum by its
+// length, or an empty string if it is not a checksum.
+func hashAlgorithm(sum string) string {
+	if _, err := hex.DecodeString(sum); err != nil {
+		return ""
+	}
+	switch len(sum) {
+	case md5.Size * 2:
+		return "md5"
+	case sha256.Size * 2:
+		return "sha256"
+	case sha512.Size * 2:
+		return "sha512"
+	}
+	return ""
+}
+
+// assetRegexp returns the regular expression for the asset pattern with
+// {repo} replaced by the name of the repository.
+func assetRegexp(pattern, repo string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(strings.Replace(pattern, "{repo}", regexp.QuoteMeta(repo), -1))
+	if err != nil {
+		return nil, fmt.Errorf("parsing asset pattern %q failed: %v", pattern, err)
+	}
+	names := re.SubexpNames()
+	if !in(names, "os") || !in(names, "arch") {
+		return nil, fmt.Errorf("asset pattern %q must have the os and arch named groups, e.g. (?P<os>[^-]+)", pattern)
+	}
+	return re, nil
+}
+
+// releaseTemplate returns the template for the release body of the
+// repository: the one passed on the command line, the one committed in the
+// repository or the built-in one, in that order.
+func (cmd *releaseCommand) releaseTemplate(ctx context.Context, client *github.Client, repo *github.Repository) (*template.Template, error) {
+	if cmd.tmpl != nil {
+		return cmd.tmpl, nil
+	}
+
+	file, _, resp, err := client.Repositories.GetContents(ctx, repo.GetOwner().GetLogin(), repo.GetName(), releaseTemplatePath, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return parseReleaseTemplate(releaseTmpl)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%s in %s is not a file", releaseTemplatePath, repo.GetFullName())
+	}
+
+	s, err := file.GetContent()
+	if err != nil {
+		return nil, err
+	}
+	t, err := parseReleaseTemplate(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s in %s failed: %v", releaseTemplatePath, repo.GetFullName(), err)
+	}
+	logrus.Debugf("Using the release template from %s in %s", releaseTemplatePath, repo.GetFullName())
+	return t, nil
+}
+
+// parseReleaseTemplate parses the template for a release body with the extra
+// functions and the << >> delimiters.
+func parseReleaseTemplate(text string) (*template.Template, error) {
+	funcMap := template.FuncMap{
+		"ToUpper":    strings.ToUpper,
+		"ToLower":    strings.ToLower,
+		"Title":      strings.Title,
+		"Replace":    strings.Replace,
+		"TrimPrefix": strings.TrimPrefix,
+		"TrimSuffix": strings.TrimSuffix,
+		"HasPrefix":  strings.HasPrefix,
+		"HasSuffix":  strings.HasSuffix,
+		"Contains":   strings.Contains,
+		"Join":       strings.Join,
+	}
+	return template.New("").Funcs(funcMap).Delims("<<", ">>").Parse(text)
+}
+
+// releaseData is the data the release body template is executed with.
+type releaseData struct {
+	Repository  *github.Repository
+	Release     *github.RepositoryRelease
+	PreviousTag string
+	// Assets holds the binaries by OS and then architecture.
+	Assets map[string]map[string]release
+	// Checksums holds the SHA256 checksums by binary name.
+	Checksums map[string]string
+
+	// changelog is prepended to the rendered template.
+	changelog string
+}
+
 type release struct {
+	assetID   int64
+	signature []byte
+
 	Repository   *github.Repository
 	Release      *github.RepositoryRelease
+	OS           string
+	Arch         string
+	Version      string
+	Ext          string
 	BinaryName   string
 	BinaryURL    string
 	BinarySHA256 string
+	BinarySHA512 string
 	BinaryMD5    string
 	BinarySince  string
+
+	SignatureName string
+	SignatureURL  string
+	// Signer is the name of the signer if the key is in the keyring, else
+	// the ID of the key.
+	Signer string
 }
 
-func updateRelease(ctx context.Context, client *github.Client, repo *github.Repository, r *github.RepositoryRelease, releases map[string]map[string]release) error {
-	var (
-		b bytes.Buffer
-	)
+func updateRelease(ctx context.Context, client *github.Client, repo *github.Repository, r *github.RepositoryRelease, t *template.Template, data releaseData) error {
+	s, err := renderReleaseBody(t, data)
+	if err != nil {
+		return err
+	}
 
-	// Parse the template.
-	funcMap := template.FuncMap{
-		"ToUpper": strings.ToUpper,
+	body := mergeReleaseBody(r.GetBody(), s)
+	if body == r.GetBody() && r.GetName() == r.GetTagName() {
+		fmt.Printf("[OK] %s release %s is up to date\n", repo.GetFullName(), r.GetTagName())
+		return nil
 	}
-	t := template.Must(template.New("").Funcs(funcMap).Delims("<<", ">>").Parse(releaseTmpl))
-	w := io.Writer(&b)
 
-	// Execute the template.
-	if err := t.Execute(w, releases); err != nil {
-		return err
+	if dryrun {
+		fmt.Printf("[UPDATE] %s release %s body will be changed:\n", repo.GetFullName(), r.GetTagName())
+		for _, l := range diffLines(r.GetBody(), body) {
+			fmt.Printf("\t%s\n", l)
+		}
+		return nil
 	}
 
-	s := b.String()
-	r.Body = &s
+	r.Body = &body
 	r.Name = r.TagName
 
 	// Send the new body to GitHub to update the release.
 	logrus.Debugf("Updating release for %s -> %s...", repo.GetFullName(), r.GetTagName())
 	_, resp, err := client.Repositories.EditRelease(ctx, repo.GetOwner().GetLogin(), repo.GetName(), r.GetID(), r)
-	if resp.StatusCode == http.StatusForbidden {
+	if resp != nil && resp.StatusCode == http.StatusForbidden {
 		return nil
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[OK] %s release %s is updated\n", repo.GetFullName(), r.GetTagName())
+
+	return nil
 }
 
-func getReleaseAssetContent(ctx context.Context, client *github.Client, repo *github.Repository, id int64) (string, error) {
-	body, redirectURL, err := client.Repositories.DownloadReleaseAsset(ctx, repo.GetOwner().GetLogin(), repo.GetName(), id)
-	if err != nil {
-		return "", err
+// mergeReleaseBody replaces the generated section between the markers in the
+// body, or appends it if there is none, so the notes written by hand are kept.
+func mergeReleaseBody(body, generated string) string {
+	section := releaseBegin + "\n" + strings.TrimSpace(generated) + "\n" + releaseEnd
+
+	begin := strings.Index(body, releaseBegin)
+	end := strings.Index(body, releaseEnd)
+	if begin >= 0 && end > begin {
+		return body[:begin] + section + body[end+len(releaseEnd):]
 	}
-	if body == nil && len(redirectURL) > 0 {
-		resp, err := http.Get(redirectURL)
-		if err != nil {
-			return "", fmt.Errorf("getting redirect url %s failed: %v", redirectURL, err)
+
+	if len(strings.TrimSpace(body)) < 1 {
+		return section
+	}
+
+	// Bodies generated before the markers were added start with the built-in
+	// template, replace it instead of keeping two copies but keep the notes
+	// that were written below it.
+	if end := legacyReleaseBodyEnd(body); end >= 0 {
+		rest := strings.TrimLeft(body[end:], "\r\n")
+		if len(strings.TrimSpace(rest)) < 1 {
+			return section
 		}
-		body = resp.Body
+		return section + "\n\n" + rest
 	}
-	if body == nil {
-		return "", errors.New("body for asset was nil")
+	return strings.TrimRight(body, "\n") + "\n\n" + section
+}
+
+// legacyReleaseBodyEnd returns the offset in the body where the release notes
+// generated with the built-in template before the markers were added end, or
+// -1 if the body does not start with them. The generated notes are the first
+// line of the template followed by the OS and architecture headings and
+// their code blocks, they end with the last closing code fence before the
+// text written by hand.
+func legacyReleaseBodyEnd(body string) int {
+	first := strings.SplitN(releaseTmpl, "\n", 2)[0]
+	trimmed := strings.TrimLeft(body, " \t\r\n")
+	if !strings.HasPrefix(trimmed, first) {
+		return -1
+	}
+
+	lines := strings.SplitAfter(trimmed, "\n")
+	offset := len(body) - len(trimmed) + len(lines[0])
+	end := offset
+	fenced := false
+	for _, line := range lines[1:] {
+		offset += len(line)
+		l := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(l, "```"):
+			fenced = !fenced
+			if !fenced {
+				end = offset
+			}
+		case fenced, len(l) < 1, strings.HasPrefix(l, "#### "), strings.HasPrefix(l, "##### ") && strings.Contains(l, " - "):
+		default:
+			return end
+		}
+	}
+	if fenced {
+		return end
+	}
+	return len(body)
+}
+
+// diffLines returns the lines that were removed from a prefixed with '-' and
+// the ones added in b prefixed with '+', in the order they appear.
+func diffLines(a, b string) []string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// lcs[i][j] holds the length of the longest common subsequence of x[i:]
+	// and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	diff := []string{}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			diff = append(diff, "- "+x[i])
+			i++
+		default:
+			diff = append(diff, "+ "+y[j])
+			j++
+		}
+	}
+	return diff
+}
+
+// renderReleaseBody executes the template with the data, after the changelog
+// if there is one. The result is Markdown so nothing is escaped.
+func renderReleaseBody(t *template.Template, data releaseData) (string, error) {
+	var b bytes.Buffer
+	if len(data.changelog) > 0 {
+		b.WriteString(data.changelog + "\n")
+	}
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func getReleaseAssetContent(ctx context.Context, client *github.Client, repo *github.Repository, id int64) (string, error) {
+	body, err := downloadReleaseAsset(ctx, client, repo, id)
+	if err != nil {
+		return "", err
 	}
 	defer body.Close()
 
@@ -229,5 +903,33 @@ func getReleaseAssetContent(ctx context.Context, client *github.Client, repo *gi
 		return "", err
 	}
 
-	return strings.Split(string(b), " ")[0], nil
+	return string(b), nil
+}
+
+// downloadReleaseAsset returns the content of the asset, following the
+// redirect to where it is stored. The caller has to close it.
+func downloadReleaseAsset(ctx context.Context, client *github.Client, repo *github.Repository, id int64) (io.ReadCloser, error) {
+	body, redirectURL, err := client.Repositories.DownloadReleaseAsset(ctx, repo.GetOwner().GetLogin(), repo.GetName(), id)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil && len(redirectURL) > 0 {
+		req, err := http.NewRequest("GET", redirectURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("getting redirect url %s failed: %v", redirectURL, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("getting redirect url %s failed: %s", redirectURL, resp.Status)
+		}
+		body = resp.Body
+	}
+	if body == nil {
+		return nil, errors.New("body for asset was nil")
+	}
+	return body, nil
 }
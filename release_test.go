@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/crypto/openpgp"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestRenderReleaseBody(t *testing.T) {
+	repo := &github.Repository{
+		Name:     github.String("img"),
+		FullName: github.String("genuinetools/img"),
+		HTMLURL:  github.String("https://github.com/genuinetools/img"),
+	}
+	r := &github.RepositoryRelease{
+		TagName: github.String("v0.5.0"),
+	}
+	asset := func(name, sum string) release {
+		return release{
+			Repository:   repo,
+			BinaryName:   name,
+			BinaryURL:    "https://github.com/genuinetools/img/releases/download/v0.5.0/" + name,
+			BinarySHA256: sum,
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		template string
+		data     releaseData
+	}{
+		{
+			name:     "single",
+			template: releaseTmpl,
+			data: releaseData{
+				Repository: repo,
+				Release:    r,
+				Assets: map[string]map[string]release{
+					"linux": {
+						"amd64": asset("img-linux-amd64", "3e1bb2ba3a2b6a0a1ba1e4d3b8f15a1e6d7c2f64ac2c1f0b2d8a4c6f0e9d1b7a"),
+					},
+				},
+			},
+		},
+		{
+			name:     "multiple",
+			template: releaseTmpl,
+			data: releaseData{
+				Repository: repo,
+				Release:    r,
+				Assets: map[string]map[string]release{
+					"linux": {
+						"amd64": asset("img-linux-amd64", "3e1bb2ba3a2b6a0a1ba1e4d3b8f15a1e6d7c2f64ac2c1f0b2d8a4c6f0e9d1b7a"),
+						"arm64": asset("img-linux-arm64", "9d0f3b5e6c1a2b4d8e7f6a5c3b2d1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d"),
+					},
+					"darwin": {
+						"amd64": asset("img-darwin-amd64", "0a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f9"),
+					},
+				},
+			},
+		},
+		{
+			name:     "missing-checksum",
+			template: releaseTmpl,
+			data: releaseData{
+				Repository: repo,
+				Release:    r,
+				Assets: map[string]map[string]release{
+					"linux": {
+						"amd64": asset("img-linux-amd64", ""),
+					},
+				},
+			},
+		},
+		{
+			name:     "signed",
+			template: releaseTmpl,
+			data: releaseData{
+				Repository: repo,
+				Release:    r,
+				Assets: map[string]map[string]release{
+					"linux": {
+						"amd64": func() release {
+							a := asset("img-linux-amd64", "3e1bb2ba3a2b6a0a1ba1e4d3b8f15a1e6d7c2f64ac2c1f0b2d8a4c6f0e9d1b7a")
+							a.SignatureName = "img-linux-amd64.asc"
+							a.SignatureURL = "https://github.com/genuinetools/img/releases/download/v0.5.0/img-linux-amd64.asc"
+							a.Signer = "Jane Doe <jane@example.com>"
+							return a
+						}(),
+					},
+				},
+			},
+		},
+		{
+			name:     "changelog",
+			template: releaseTmpl,
+			data: releaseData{
+				Repository:  repo,
+				Release:     r,
+				PreviousTag: "v0.4.0",
+				Assets: map[string]map[string]release{
+					"linux": {
+						"amd64": asset("img-linux-amd64", "3e1bb2ba3a2b6a0a1ba1e4d3b8f15a1e6d7c2f64ac2c1f0b2d8a4c6f0e9d1b7a"),
+					},
+				},
+				changelog: formatChangelog("v0.4.0", []changelogEntry{
+					{Title: "Add rootless builds", Ref: "#101", Author: "@jane", Labels: []string{"Feature"}},
+					{Title: "Fix cache mounts", Ref: "#102", Author: "@john", Labels: []string{"bug", "feature"}},
+					{Title: "Fix the build on arm", Ref: "#103", Author: "@jane", Labels: []string{"bug"}},
+					{Title: "Bump version", Ref: "a1b2c3d", Author: "Jane Doe"},
+				}, defaultChangelogSections),
+			},
+		},
+		{
+			name:     "goreleaser",
+			template: releaseTmpl,
+			data: releaseData{
+				Repository: repo,
+				Release:    r,
+				Assets: map[string]map[string]release{
+					"linux": {
+						"amd64": func() release {
+							a := asset("img_0.5.0_linux_amd64.tar.gz", "3e1bb2ba3a2b6a0a1ba1e4d3b8f15a1e6d7c2f64ac2c1f0b2d8a4c6f0e9d1b7a")
+							a.Ext = ".tar.gz"
+							a.SignatureName = "img_0.5.0_linux_amd64.tar.gz.asc"
+							a.SignatureURL = "https://github.com/genuinetools/img/releases/download/v0.5.0/img_0.5.0_linux_amd64.tar.gz.asc"
+							return a
+						}(),
+					},
+					"windows": {
+						"amd64": func() release {
+							a := asset("img_0.5.0_windows_amd64.zip", "0a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f9")
+							a.Ext = ".zip"
+							return a
+						}(),
+					},
+				},
+			},
+		},
+		{
+			name:     "no-assets",
+			template: releaseTmpl,
+			data: releaseData{
+				Repository: repo,
+				Release:    r,
+			},
+		},
+		{
+			name:     "custom",
+			template: "Changes since << .PreviousTag >>: << .Repository.HTMLURL >>/compare/<< .PreviousTag >>...<< .Release.TagName >>\n\n<< range $name, $sum := .Checksums >>- `<< $name >>` \"<< $sum >>\" & more\n<< end >>",
+			data: releaseData{
+				Repository:  repo,
+				Release:     r,
+				PreviousTag: "v0.4.0",
+				Checksums: map[string]string{
+					"img-linux-amd64":  "3e1bb2ba3a2b6a0a1ba1e4d3b8f15a1e6d7c2f64ac2c1f0b2d8a4c6f0e9d1b7a",
+					"img-darwin-amd64": "0a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f9",
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := parseReleaseTemplate(tc.template)
+			if err != nil {
+				t.Fatalf("parsing template failed: %v", err)
+			}
+
+			got, err := renderReleaseBody(tmpl, tc.data)
+			if err != nil {
+				t.Fatalf("rendering release body failed: %v", err)
+			}
+
+			golden := filepath.Join("testdata", "release", tc.name+".md")
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("release body does not match %s, run the tests with -update if the change is expected\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestMergeReleaseBody(t *testing.T) {
+	testCases := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "empty",
+			body: "",
+			want: "<!-- pepper:begin -->\ngenerated\n<!-- pepper:end -->",
+		},
+		{
+			name: "append",
+			body: "Hand written changelog.\n",
+			want: "Hand written changelog.\n\n<!-- pepper:begin -->\ngenerated\n<!-- pepper:end -->",
+		},
+		{
+			name: "replace",
+			body: "Before.\n\n<!-- pepper:begin -->\nold\n<!-- pepper:end -->\n\nAfter.",
+			want: "Before.\n\n<!-- pepper:begin -->\ngenerated\n<!-- pepper:end -->\n\nAfter.",
+		},
+		{
+			name: "legacy generated body",
+			body: "Below are easy install instructions by OS and Architecture. As always there are always the standard instructions in the [README.md](README.md) as well.\n\n#### linux\n",
+			want: "<!-- pepper:begin -->\ngenerated\n<!-- pepper:end -->",
+		},
+		{
+			name: "legacy generated body with hand written notes",
+			body: "Below are easy install instructions by OS and Architecture. As always there are always the standard instructions in the [README.md](README.md) as well.\n\n#### linux\n\n##### amd64 - linux\n\n```console\n$ curl -fSL \"https://example.com/img-linux-amd64\"\n```\n\n#### windows\n\n##### amd64 - windows\n\n```console\n$ curl -fSL \"https://example.com/img-windows-amd64\"\n```\n\n## Known issues\n\n```console\n$ img --workaround\n```\n",
+			want: "<!-- pepper:begin -->\ngenerated\n<!-- pepper:end -->\n\n## Known issues\n\n```console\n$ img --workaround\n```\n",
+		},
+		{
+			name: "markers out of order",
+			body: "<!-- pepper:end --> <!-- pepper:begin -->",
+			want: "<!-- pepper:end --> <!-- pepper:begin -->\n\n<!-- pepper:begin -->\ngenerated\n<!-- pepper:end -->",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := mergeReleaseBody(tc.body, "generated\n"); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	got := strings.Join(diffLines("a\nb\nc", "a\nx\nc\nd"), "\n")
+	want := "- b\n+ x\n+ d"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAssetPatterns(t *testing.T) {
+	testCases := []struct {
+		preset string
+		name   string
+		want   map[string]string // nil if the name should not match
+	}{
+		{"default", "img-linux-amd64", map[string]string{"os": "linux", "arch": "amd64"}},
+		{"default", "img-linux-arm-v7", map[string]string{"os": "linux", "arch": "arm-v7"}},
+		{"default", "img-windows-amd64.exe", map[string]string{"os": "windows", "arch": "amd64", "ext": ".exe"}},
+		{"default", "img-linux-amd64.md5", nil},
+		{"default", "reg-linux-amd64", nil},
+		{"goreleaser", "img_1.2.3_linux_amd64.tar.gz", map[string]string{"version": "1.2.3", "os": "linux", "arch": "amd64", "ext": ".tar.gz"}},
+		{"goreleaser", "img_1.2.3_windows_386.zip", map[string]string{"version": "1.2.3", "os": "windows", "arch": "386", "ext": ".zip"}},
+		{"goreleaser", "checksums.txt", nil},
+		{"gox", "img_darwin_amd64", map[string]string{"os": "darwin", "arch": "amd64"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.preset+"/"+tc.name, func(t *testing.T) {
+			re, err := assetRegexp(assetPatterns[tc.preset], "img")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := re.FindStringSubmatch(tc.name)
+			if tc.want == nil {
+				if m != nil {
+					t.Fatalf("expected %s not to match, got %v", tc.name, m)
+				}
+				return
+			}
+			if m == nil {
+				t.Fatalf("expected %s to match", tc.name)
+			}
+			for i, n := range re.SubexpNames() {
+				if len(n) > 0 && m[i] != tc.want[n] {
+					t.Errorf("%s: got %q, want %q", n, m[i], tc.want[n])
+				}
+			}
+		})
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	sha256sum := strings.Repeat("a", 64)
+	sha512sum := strings.Repeat("b", 128)
+	md5sum := strings.Repeat("c", 32)
+
+	s := sha256sum + "  img-linux-amd64\n" +
+		sha512sum + " *img-windows-amd64.exe\n" +
+		md5sum + "  img-darwin-amd64\n" +
+		"# not a checksum\n" +
+		strings.Repeat("z", 64) + "  img-linux-386\n"
+
+	got := parseChecksums(s)
+	want := []checksumLine{
+		{name: "img-linux-amd64", algo: "sha256", sum: sha256sum},
+		{name: "img-windows-amd64.exe", algo: "sha512", sum: sha512sum},
+		{name: "img-darwin-amd64", algo: "md5", sum: md5sum},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d checksums, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("checksum %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestIsChecksumAsset(t *testing.T) {
+	for name, want := range map[string]bool{
+		"SHA256SUMS":                true,
+		"sha512sums.txt":            true,
+		"img_1.2.3_checksums.txt":   true,
+		"img-linux-amd64.sha256":    true,
+		"img-linux-amd64.md5":       true,
+		"img-linux-amd64":           false,
+		"img-linux-amd64.asc":       false,
+		"img_1.2.3_linux_amd64.zip": false,
+	} {
+		if got := isChecksumAsset(name); got != want {
+			t.Errorf("%s: got %t, want %t", name, got, want)
+		}
+	}
+}
+
+func TestSignature(t *testing.T) {
+	e, err := openpgp.NewEntity("Jane Doe", "", "jane@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := openpgp.NewEntity("John Doe", "", "john@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binary := []byte("#!/bin/sh\necho img\n")
+	var armored, raw bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&armored, e, bytes.NewReader(binary), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := openpgp.DetachSign(&raw, e, bytes.NewReader(binary), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, sig := range map[string][]byte{"armored": armored.Bytes(), "binary": raw.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			keyring := openpgp.EntityList{other, e}
+
+			want := "Jane Doe <jane@example.com>"
+			if got := signer(sig, keyring); got != want {
+				t.Errorf("signer: got %q, want %q", got, want)
+			}
+			if got, want := signer(sig, nil), e.PrimaryKey.KeyIdString(); got != want {
+				t.Errorf("signer without keyring: got %q, want %q", got, want)
+			}
+
+			signedBy, err := checkSignature(keyring, bytes.NewReader(binary), sig)
+			if err != nil {
+				t.Fatalf("checking signature failed: %v", err)
+			}
+			if got := entityName(signedBy); got != want {
+				t.Errorf("signed by: got %q, want %q", got, want)
+			}
+
+			if _, err := checkSignature(keyring, bytes.NewReader(append(binary, 'x')), sig); err == nil {
+				t.Error("expected the signature of tampered content to be invalid")
+			}
+			if _, err := checkSignature(openpgp.EntityList{other}, bytes.NewReader(binary), sig); err == nil {
+				t.Error("expected the signature to be invalid without the key in the keyring")
+			}
+		})
+	}
+}
+
+func TestFormatChangelog(t *testing.T) {
+	sections := []changelogSection{
+		{Title: "Bug Fixes", Labels: []string{"bug"}},
+		{Title: "Features", Labels: []string{"feature"}},
+	}
+	entries := []changelogEntry{
+		{Title: "Add rootless builds", Ref: "#101", Author: "@jane", Labels: []string{"feature"}},
+		{Title: "Fix cache mounts", Ref: "#102", Author: "@john", Labels: []string{"feature", "bug"}},
+		{Title: "Update docs", Ref: "#104", Author: "@jane", Labels: []string{"docs"}},
+	}
+
+	got := formatChangelog("v0.4.0", entries, sections)
+	want := `## Changes since v0.4.0
+
+### Bug Fixes
+
+- Fix cache mounts (#102) @john
+
+### Features
+
+- Add rootless builds (#101) @jane
+
+### Other Changes
+
+- Update docs (#104) @jane
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got, want := formatChangelog("v0.4.0", nil, sections), "## Changes since v0.4.0\n\nNo changes.\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPreviousRelease(t *testing.T) {
+	releases := []*github.RepositoryRelease{
+		{TagName: github.String("v0.6.0"), Draft: github.Bool(true)},
+		{TagName: github.String("v0.6.0-rc.1"), Prerelease: github.Bool(true)},
+		{TagName: github.String("v0.5.0")},
+		{TagName: github.String("v0.4.0")},
+	}
+
+	if got, want := previousRelease(releases), "v0.5.0"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := previousRelease(releases[:2]); got != "" {
+		t.Errorf("got %q, want no previous release", got)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/sirupsen/logrus"
+)
+
+// changelogSection groups the changes with any of the labels in the
+// changelog. The changes without any of the labels of the sections are listed
+// under "Other Changes".
+type changelogSection struct {
+	Title  string   `yaml:"title"`
+	Labels []string `yaml:"labels"`
+}
+
+// defaultChangelogSections are used unless --changelog-sections is passed.
+var defaultChangelogSections = []changelogSection{
+	{Title: "Features", Labels: []string{"feature", "enhancement"}},
+	{Title: "Bug Fixes", Labels: []string{"bug", "bugfix", "fix"}},
+}
+
+// changelogEntry is a merged pull request or a commit pushed directly.
+type changelogEntry struct {
+	Title string
+	// Ref is the number of the pull request (e.g. '#123') or the short SHA of
+	// the commit.
+	Ref    string
+	Author string
+	Labels []string
+}
+
+// getChangelog returns the merged pull requests and the commits that were not
+// part of a pull request between the tags, from the oldest to the newest.
+func getChangelog(ctx context.Context, client *github.Client, repo *github.Repository, previous, tag string) ([]changelogEntry, error) {
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+
+	comparison, _, err := client.Repositories.CompareCommits(ctx, owner, name, previous, tag)
+	if err != nil {
+		return nil, fmt.Errorf("comparing %s...%s of %s failed: %v", previous, tag, repo.GetFullName(), err)
+	}
+	if comparison.GetTotalCommits() > len(comparison.Commits) {
+		logrus.Warnf("%s has %d commits between %s and %s, only the first %d are in the changelog", repo.GetFullName(), comparison.GetTotalCommits(), previous, tag, len(comparison.Commits))
+	}
+
+	entries := []changelogEntry{}
+	seen := map[int]bool{}
+	for _, c := range comparison.Commits {
+		var pulls []*github.PullRequest
+		if _, err := doRequest(ctx, client, "GET", fmt.Sprintf("repos/%s/%s/commits/%s/pulls", owner, name, c.GetSHA()), nil, &pulls); err != nil {
+			return nil, fmt.Errorf("getting the pull requests of commit %s in %s failed: %v", c.GetSHA(), repo.GetFullName(), err)
+		}
+
+		var pr *github.PullRequest
+		for _, p := range pulls {
+			if p.MergedAt != nil {
+				pr = p
+				break
+			}
+		}
+
+		if pr != nil {
+			if seen[pr.GetNumber()] {
+				continue
+			}
+			seen[pr.GetNumber()] = true
+
+			labels := []string{}
+			for _, l := range pr.Labels {
+				labels = append(labels, l.GetName())
+			}
+			entries = append(entries, changelogEntry{
+				Title:  pr.GetTitle(),
+				Ref:    fmt.Sprintf("#%d", pr.GetNumber()),
+				Author: "@" + pr.GetUser().GetLogin(),
+				Labels: labels,
+			})
+			continue
+		}
+
+		// Skip the merge commits of branches that were not pull requests.
+		if len(c.Parents) > 1 {
+			continue
+		}
+
+		author := c.GetCommit().GetAuthor().GetName()
+		if len(c.GetAuthor().GetLogin()) > 0 {
+			author = "@" + c.GetAuthor().GetLogin()
+		}
+		sha := c.GetSHA()
+		if len(sha) > 7 {
+			sha = sha[:7]
+		}
+		entries = append(entries, changelogEntry{
+			Title:  strings.SplitN(c.GetCommit().GetMessage(), "\n", 2)[0],
+			Ref:    sha,
+			Author: author,
+		})
+	}
+
+	return entries, nil
+}
+
+// formatChangelog returns the changes grouped by section as Markdown, the
+// first section with a label of the change wins.
+func formatChangelog(previous string, entries []changelogEntry, sections []changelogSection) string {
+	grouped := make([][]changelogEntry, len(sections)+1)
+	for _, e := range entries {
+		i := sectionIndex(e, sections)
+		grouped[i] = append(grouped[i], e)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "## Changes since %s\n", previous)
+	if len(entries) < 1 {
+		b.WriteString("\nNo changes.\n")
+	}
+	for i, group := range grouped {
+		if len(group) < 1 {
+			continue
+		}
+		title := "Other Changes"
+		if i < len(sections) {
+			title = sections[i].Title
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n", title)
+		for _, e := range group {
+			fmt.Fprintf(&b, "- %s (%s) %s\n", e.Title, e.Ref, e.Author)
+		}
+	}
+	return b.String()
+}
+
+// sectionIndex returns the index of the first section with one of the labels
+// of the change, or len(sections) if there is none.
+func sectionIndex(e changelogEntry, sections []changelogSection) int {
+	for i, s := range sections {
+		for _, l := range e.Labels {
+			for _, sl := range s.Labels {
+				if strings.EqualFold(l, sl) {
+					return i
+				}
+			}
+		}
+	}
+	return len(sections)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// addReleaseChecksums uploads the missing .sha256, and with --sha512 .sha512,
+// checksum assets for the binaries of the release. It returns true if there
+// were checksums missing.
+func (cmd *releaseCommand) addReleaseChecksums(ctx context.Context, client *github.Client, repo *github.Repository, r *github.RepositoryRelease, re *regexp.Regexp) (bool, error) {
+	binaries, err := listReleaseBinaries(ctx, client, repo, r, re, cmd.keyring)
+	if err != nil {
+		return false, err
+	}
+
+	missing := false
+	for _, a := range binaries {
+		algos := []string{}
+		if len(a.BinarySHA256) < 1 {
+			algos = append(algos, "sha256")
+		}
+		if cmd.sha512 && len(a.BinarySHA512) < 1 {
+			algos = append(algos, "sha512")
+		}
+		if len(algos) < 1 {
+			continue
+		}
+		missing = true
+
+		if dryrun {
+			fmt.Printf("[UPDATE] %s %s %s will have its %s checksums uploaded\n", repo.GetFullName(), r.GetTagName(), a.BinaryName, strings.Join(algos, ", "))
+			continue
+		}
+
+		body, err := downloadReleaseAsset(ctx, client, repo, a.assetID)
+		if err != nil {
+			return false, fmt.Errorf("downloading %s of %s %s failed: %v", a.BinaryName, repo.GetFullName(), r.GetTagName(), err)
+		}
+		sums := newChecksummer()
+		_, err = io.Copy(sums, body)
+		body.Close()
+		if err != nil {
+			return false, fmt.Errorf("downloading %s of %s %s failed: %v", a.BinaryName, repo.GetFullName(), r.GetTagName(), err)
+		}
+
+		computed := sums.sums()
+		for _, algo := range algos {
+			// Use the same format as sha256sum so the file can be checked
+			// with `sha256sum -c`.
+			content := fmt.Sprintf("%s  %s\n", computed[algo], a.BinaryName)
+			if _, err := uploadReleaseAsset(ctx, client, repo, r, a.BinaryName+"."+algo, strings.NewReader(content)); err != nil {
+				return false, err
+			}
+		}
+		fmt.Printf("[OK] %s %s %s has its %s checksums uploaded\n", repo.GetFullName(), r.GetTagName(), a.BinaryName, strings.Join(algos, ", "))
+	}
+
+	return missing, nil
+}
+
+// uploadReleaseAsset uploads the content as an asset of the release. The
+// GitHub client only uploads files, so the content is written to a temporary
+// file first.
+func uploadReleaseAsset(ctx context.Context, client *github.Client, repo *github.Repository, r *github.RepositoryRelease, name string, content io.Reader) (*github.ReleaseAsset, error) {
+	f, err := ioutil.TempFile("", "pepper-asset-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := io.Copy(f, content); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	asset, _, err := client.Repositories.UploadReleaseAsset(ctx, repo.GetOwner().GetLogin(), repo.GetName(), r.GetID(), &github.UploadOptions{Name: name}, f)
+	if err != nil {
+		return nil, fmt.Errorf("uploading %s to %s %s failed: %v", name, repo.GetFullName(), r.GetTagName(), err)
+	}
+	return asset, nil
+}
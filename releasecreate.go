@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// localAsset is an asset to upload to the release, either a file in the
+// directory or generated content like checksums.
+type localAsset struct {
+	name    string
+	path    string
+	content []byte
+	size    int64
+	sha256  string
+}
+
+// createRelease creates a draft of the release, or updates the existing
+// draft, uploads the assets from the directory, publishes it and renders the
+// body.
+func (cmd *releaseCommand) createRelease(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	// The search for --repo is fuzzy and can return another repository with a
+	// similar name, make sure not to publish a release there.
+	if !strings.EqualFold(repo.GetFullName(), singleRepo) {
+		return fmt.Errorf("the search for %s returned %s, not creating a release in it", singleRepo, repo.GetFullName())
+	}
+
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+
+	re, err := assetRegexp(cmd.assetPattern, repo.GetName())
+	if err != nil {
+		return err
+	}
+
+	assets, err := cmd.localReleaseAssets(re)
+	if err != nil {
+		return err
+	}
+
+	releases, _, err := listReleases(ctx, client, repo)
+	if err != nil {
+		return err
+	}
+
+	var r *github.RepositoryRelease
+	others := []*github.RepositoryRelease{}
+	for _, rel := range releases {
+		if rel.GetTagName() == cmd.tag {
+			r = rel
+			continue
+		}
+		others = append(others, rel)
+	}
+	previous := previousRelease(others)
+
+	if r != nil && !r.GetDraft() {
+		return fmt.Errorf("release %s of %s is already published, only drafts can be updated", cmd.tag, repo.GetFullName())
+	}
+
+	if r == nil {
+		if dryrun {
+			fmt.Printf("[UPDATE] %s release %s will be created as a draft\n", repo.GetFullName(), cmd.tag)
+			r = &github.RepositoryRelease{TagName: github.String(cmd.tag)}
+		} else {
+			r, _, err = client.Repositories.CreateRelease(ctx, owner, name, &github.RepositoryRelease{
+				TagName: github.String(cmd.tag),
+				Name:    github.String(cmd.tag),
+				Draft:   github.Bool(true),
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("[OK] %s release %s is created as a draft\n", repo.GetFullName(), cmd.tag)
+		}
+	}
+
+	existing := map[string]github.ReleaseAsset{}
+	for _, a := range r.Assets {
+		existing[a.GetName()] = a
+	}
+
+	for _, a := range assets {
+		if old, ok := existing[a.name]; ok {
+			same, err := sameReleaseAsset(ctx, client, repo, old, a)
+			if err != nil {
+				return err
+			}
+			if same {
+				fmt.Printf("[OK] %s release %s already has %s\n", repo.GetFullName(), cmd.tag, a.name)
+				continue
+			}
+
+			if dryrun {
+				fmt.Printf("[UPDATE] %s release %s will have %s replaced\n", repo.GetFullName(), cmd.tag, a.name)
+				continue
+			}
+
+			// Assets can not be overwritten, so remove the old one first.
+			if _, err := client.Repositories.DeleteReleaseAsset(ctx, owner, name, old.GetID()); err != nil {
+				return err
+			}
+		} else if dryrun {
+			fmt.Printf("[UPDATE] %s release %s will have %s uploaded\n", repo.GetFullName(), cmd.tag, a.name)
+			continue
+		}
+
+		if err := a.upload(ctx, client, repo, r); err != nil {
+			return err
+		}
+		fmt.Printf("[OK] %s release %s has %s uploaded\n", repo.GetFullName(), cmd.tag, a.name)
+	}
+
+	if dryrun {
+		if !cmd.draft {
+			fmt.Printf("[UPDATE] %s release %s will be published\n", repo.GetFullName(), cmd.tag)
+		}
+		fmt.Printf("[UPDATE] %s release %s body will be rendered\n", repo.GetFullName(), cmd.tag)
+		return nil
+	}
+
+	// Publish the release before rendering the body, the assets of a draft
+	// have download URLs that break once it is published and the tag might
+	// not exist yet for the changelog.
+	if !cmd.draft {
+		if _, _, err := client.Repositories.EditRelease(ctx, owner, name, r.GetID(), &github.RepositoryRelease{
+			Draft: github.Bool(false),
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("[OK] %s release %s is published\n", repo.GetFullName(), cmd.tag)
+	}
+
+	// Get the release again for the uploaded assets and their URLs.
+	r, _, err = client.Repositories.GetRelease(ctx, owner, name, r.GetID())
+	if err != nil {
+		return err
+	}
+
+	t, err := cmd.releaseTemplate(ctx, client, repo)
+	if err != nil {
+		return err
+	}
+	if err := cmd.renderRelease(ctx, client, repo, r, t, re, previous); err != nil {
+		return err
+	}
+
+	if cmd.draft {
+		fmt.Printf("[OK] %s release %s is left as a draft\n", repo.GetFullName(), cmd.tag)
+	}
+
+	return nil
+}
+
+// localReleaseAssets returns the binaries in the directory that match the
+// asset pattern, their generated checksums and their signatures.
+func (cmd *releaseCommand) localReleaseAssets(re *regexp.Regexp) ([]localAsset, error) {
+	files, err := ioutil.ReadDir(cmd.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory %s failed: %v", cmd.dir, err)
+	}
+
+	binaries := map[string]bool{}
+	assets := []localAsset{}
+	for _, f := range files {
+		if !f.Mode().IsRegular() || isChecksumAsset(f.Name()) || isSignatureAsset(f.Name()) || !re.MatchString(f.Name()) {
+			continue
+		}
+		binaries[f.Name()] = true
+
+		p := filepath.Join(cmd.dir, f.Name())
+		sums, err := hashFile(p)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, localAsset{
+			name:   f.Name(),
+			path:   p,
+			size:   f.Size(),
+			sha256: sums["sha256"],
+		})
+
+		algos := []string{"sha256"}
+		if cmd.sha512 {
+			algos = append(algos, "sha512")
+		}
+		for _, algo := range algos {
+			// Use the same format as sha256sum so the file can be checked
+			// with `sha256sum -c`.
+			assets = append(assets, newLocalAsset(f.Name()+"."+algo, []byte(fmt.Sprintf("%s  %s\n", sums[algo], f.Name()))))
+		}
+	}
+
+	for _, f := range files {
+		if !f.Mode().IsRegular() || !isSignatureAsset(f.Name()) || !binaries[strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))] {
+			continue
+		}
+
+		p := filepath.Join(cmd.dir, f.Name())
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		a := newLocalAsset(f.Name(), b)
+		a.path = p
+		assets = append(assets, a)
+	}
+
+	if len(binaries) < 1 {
+		return nil, fmt.Errorf("no files in %s match the asset pattern %s", cmd.dir, re)
+	}
+
+	return assets, nil
+}
+
+// newLocalAsset returns the asset for the content.
+func newLocalAsset(name string, content []byte) localAsset {
+	sums := newChecksummer()
+	sums.Write(content)
+	return localAsset{
+		name:    name,
+		content: content,
+		size:    int64(len(content)),
+		sha256:  sums.sums()["sha256"],
+	}
+}
+
+// upload uploads the asset to the release.
+func (a localAsset) upload(ctx context.Context, client *github.Client, repo *github.Repository, r *github.RepositoryRelease) error {
+	if a.content != nil {
+		_, err := uploadReleaseAsset(ctx, client, repo, r, a.name, bytes.NewReader(a.content))
+		return err
+	}
+
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, _, err := client.Repositories.UploadReleaseAsset(ctx, repo.GetOwner().GetLogin(), repo.GetName(), r.GetID(), &github.UploadOptions{Name: a.name}, f); err != nil {
+		return fmt.Errorf("uploading %s to %s %s failed: %v", a.name, repo.GetFullName(), r.GetTagName(), err)
+	}
+	return nil
+}
+
+// sameReleaseAsset returns true if the uploaded asset has the same content as
+// the local one.
+func sameReleaseAsset(ctx context.Context, client *github.Client, repo *github.Repository, uploaded github.ReleaseAsset, a localAsset) (bool, error) {
+	if int64(uploaded.GetSize()) != a.size {
+		return false, nil
+	}
+
+	body, err := downloadReleaseAsset(ctx, client, repo, uploaded.GetID())
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+
+	sums := newChecksummer()
+	if _, err := io.Copy(sums, body); err != nil {
+		return false, err
+	}
+	return sums.sums()["sha256"] == a.sha256, nil
+}
+
+// hashFile returns the checksums of the file by algorithm.
+func hashFile(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sums := newChecksummer()
+	if _, err := io.Copy(sums, f); err != nil {
+		return nil, fmt.Errorf("reading %s failed: %v", file, err)
+	}
+	return sums.sums(), nil
+}
+
+// listReleases returns all the releases for a repository, following the
+// pagination until the last page.
+func listReleases(ctx context.Context, client *github.Client, repo *github.Repository) ([]*github.RepositoryRelease, *github.Response, error) {
+	opt := &github.ListOptions{
+		Page:    1,
+		PerPage: 100,
+	}
+
+	all := []*github.RepositoryRelease{}
+	for {
+		releases, resp, err := client.Repositories.ListReleases(ctx, repo.GetOwner().GetLogin(), repo.GetName(), opt)
+		if err != nil {
+			return nil, resp, err
+		}
+		all = append(all, releases...)
+
+		// Return if we are on the last page.
+		if resp.NextPage == 0 {
+			return all, resp, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// hashAlgorithms are the algorithms of the checksums that can be published
+// for release assets.
+var hashAlgorithms = []string{"md5", "sha256", "sha512"}
+
+// verifyRelease downloads the binaries of the release and compares them with
+// the published checksums.
+func (cmd *releaseCommand) verifyRelease(ctx context.Context, client *github.Client, repo *github.Repository, r *github.RepositoryRelease, re *regexp.Regexp) error {
+	binaries, err := listReleaseBinaries(ctx, client, repo, r, re, cmd.keyring)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range binaries {
+		published := a.checksums()
+		if len(published) < 1 && len(cmd.keyring) < 1 {
+			cmd.failed++
+			fmt.Printf("[WARN] %s %s %s has no published checksums\n", repo.GetFullName(), r.GetTagName(), a.BinaryName)
+			continue
+		}
+
+		check, err := cmd.checkReleaseAsset(ctx, client, repo, a)
+		if err != nil {
+			return fmt.Errorf("downloading %s of %s %s failed: %v", a.BinaryName, repo.GetFullName(), r.GetTagName(), err)
+		}
+
+		ok := true
+		if len(published) < 1 {
+			ok = false
+			fmt.Printf("[WARN] %s %s %s has no published checksums\n", repo.GetFullName(), r.GetTagName(), a.BinaryName)
+		}
+
+		algos := []string{}
+		for _, algo := range hashAlgorithms {
+			sum, found := published[algo]
+			if !found {
+				continue
+			}
+			algos = append(algos, algo)
+			if sum != check.sums[algo] {
+				ok = false
+				fmt.Printf("[WARN] %s %s %s does not match its %s checksum: published %s, computed %s\n", repo.GetFullName(), r.GetTagName(), a.BinaryName, algo, sum, check.sums[algo])
+			}
+		}
+
+		if len(cmd.keyring) > 0 {
+			switch {
+			case a.signature == nil:
+				ok = false
+				fmt.Printf("[WARN] %s %s %s has no signature\n", repo.GetFullName(), r.GetTagName(), a.BinaryName)
+			case check.signatureErr != nil:
+				ok = false
+				fmt.Printf("[WARN] %s %s %s signature %s is invalid: %v\n", repo.GetFullName(), r.GetTagName(), a.BinaryName, a.SignatureName, check.signatureErr)
+			}
+		}
+
+		if !ok {
+			cmd.failed++
+			continue
+		}
+
+		msg := fmt.Sprintf("matches its %s checksums", strings.Join(algos, ", "))
+		if len(algos) < 1 {
+			msg = "has no published checksums"
+		}
+		if len(check.signer) > 0 {
+			msg += " and is signed by " + check.signer
+		}
+		fmt.Printf("[OK] %s %s %s %s\n", repo.GetFullName(), r.GetTagName(), a.BinaryName, msg)
+	}
+
+	return nil
+}
+
+// assetCheck is the result of checking a binary of a release.
+type assetCheck struct {
+	// sums holds the computed checksums by algorithm.
+	sums map[string]string
+	// signer is set if the signature was checked and is valid, else
+	// signatureErr holds why it is invalid.
+	signer       string
+	signatureErr error
+}
+
+// checkReleaseAsset streams the binary to compute its checksums and, if there
+// is a keyring and a signature, to check the signature.
+func (cmd *releaseCommand) checkReleaseAsset(ctx context.Context, client *github.Client, repo *github.Repository, a release) (assetCheck, error) {
+	body, err := downloadReleaseAsset(ctx, client, repo, a.assetID)
+	if err != nil {
+		return assetCheck{}, err
+	}
+	defer body.Close()
+
+	sums := newChecksummer()
+	tee := io.TeeReader(body, sums)
+
+	check := assetCheck{}
+	if len(cmd.keyring) > 0 && a.signature != nil {
+		e, err := checkSignature(cmd.keyring, tee, a.signature)
+		if err != nil {
+			check.signatureErr = err
+		} else {
+			check.signer = entityName(e)
+		}
+	}
+
+	// Read what is left if the signature was not checked or the check failed
+	// before reading the whole binary.
+	if _, err := io.Copy(ioutil.Discard, tee); err != nil {
+		return assetCheck{}, err
+	}
+
+	check.sums = sums.sums()
+	return check, nil
+}
+
+// checksums returns the published checksums of the binary by algorithm.
+func (a release) checksums() map[string]string {
+	sums := map[string]string{}
+	for algo, sum := range map[string]string{
+		"md5":    a.BinaryMD5,
+		"sha256": a.BinarySHA256,
+		"sha512": a.BinarySHA512,
+	} {
+		if len(sum) > 0 {
+			sums[algo] = sum
+		}
+	}
+	return sums
+}
+
+// checksummer computes the checksums of everything written to it with all
+// the hash algorithms at once.
+type checksummer map[string]hash.Hash
+
+func newChecksummer() checksummer {
+	return checksummer{
+		"md5":    md5.New(),
+		"sha256": sha256.New(),
+		"sha512": sha512.New(),
+	}
+}
+
+func (c checksummer) Write(p []byte) (int, error) {
+	for _, h := range c {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// sums returns the hex encoded checksums by algorithm.
+func (c checksummer) sums() map[string]string {
+	sums := map[string]string{}
+	for algo, h := range c {
+		sums[algo] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums
+}
+
+// isSignatureAsset returns true if the asset is a detached signature.
+func isSignatureAsset(name string) bool {
+	ext := path.Ext(name)
+	return ext == ".asc" || ext == ".sig"
+}
+
+// readKeyring reads the public keys from an armored or binary keyring.
+func readKeyring(file string) (openpgp.EntityList, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading keyring %s failed: %v", file, err)
+	}
+
+	var keyring openpgp.EntityList
+	if isArmored(b) {
+		keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+	} else {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(b))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing keyring %s failed: %v", file, err)
+	}
+	return keyring, nil
+}
+
+// checkSignature checks the detached signature, armored or not, of the signed
+// content against the keyring and returns the signer.
+func checkSignature(keyring openpgp.EntityList, signed io.Reader, signature []byte) (*openpgp.Entity, error) {
+	if isArmored(signature) {
+		return openpgp.CheckArmoredDetachedSignature(keyring, signed, bytes.NewReader(signature))
+	}
+	return openpgp.CheckDetachedSignature(keyring, signed, bytes.NewReader(signature))
+}
+
+// signer returns the name of the key the signature was made with if it is in
+// the keyring, else the ID of the key. It returns an empty string if the
+// signature can not be parsed.
+func signer(signature []byte, keyring openpgp.EntityList) string {
+	var r io.Reader = bytes.NewReader(signature)
+	if isArmored(signature) {
+		block, err := armor.Decode(r)
+		if err != nil {
+			return ""
+		}
+		r = block.Body
+	}
+
+	p, err := packet.Read(r)
+	if err != nil {
+		return ""
+	}
+
+	var id uint64
+	switch sig := p.(type) {
+	case *packet.Signature:
+		if sig.IssuerKeyId == nil {
+			return ""
+		}
+		id = *sig.IssuerKeyId
+	case *packet.SignatureV3:
+		id = sig.IssuerKeyId
+	default:
+		return ""
+	}
+
+	if keys := keyring.KeysById(id); len(keys) > 0 {
+		return entityName(keys[0].Entity)
+	}
+	return fmt.Sprintf("%016X", id)
+}
+
+// entityName returns the primary identity of the key, e.g.
+// 'Jane Doe <jane@example.com>'.
+func entityName(e *openpgp.Entity) string {
+	name := ""
+	for _, id := range e.Identities {
+		if id.SelfSignature != nil && id.SelfSignature.IsPrimaryId != nil && *id.SelfSignature.IsPrimaryId {
+			return id.Name
+		}
+		if len(name) < 1 || id.Name < name {
+			name = id.Name
+		}
+	}
+	if len(name) < 1 && e.PrimaryKey != nil {
+		return e.PrimaryKey.KeyIdString()
+	}
+	return name
+}
+
+// isArmored returns true if the signature is ASCII armored.
+func isArmored(signature []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN PGP"))
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+const rulesetsHelp = `List, export, create, update and delete repository rulesets.`
+
+const rulesetsLongHelp = `List, export, create, update and delete repository rulesets.
+
+Actions:
+
+  list                  list the rulesets for the repositories, including the
+                        ones inherited from the organization
+  export                print the repository rulesets as JSON
+  create -f FILE        create the rulesets from the JSON file that do not
+                        exist yet (matched by name)
+  update -f FILE        update the existing rulesets (matched by name) that
+                        differ from the JSON file
+  delete NAME...        delete the rulesets with the given names
+
+The JSON file contains an array of rulesets in the format returned by export.`
+
+func (cmd *rulesetsCommand) Name() string      { return "rulesets" }
+func (cmd *rulesetsCommand) Args() string      { return "[OPTIONS] ACTION [NAME...]" }
+func (cmd *rulesetsCommand) ShortHelp() string { return rulesetsHelp }
+func (cmd *rulesetsCommand) LongHelp() string  { return rulesetsLongHelp }
+func (cmd *rulesetsCommand) Hidden() bool      { return false }
+
+func (cmd *rulesetsCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.file, "file", "", "JSON file containing the rulesets to create or update")
+	fs.StringVar(&cmd.file, "f", "", "JSON file containing the rulesets to create or update")
+}
+
+type rulesetsCommand struct {
+	file string
+
+	action   string
+	names    []string
+	rulesets []ruleset
+	exported []ruleset
+}
+
+// ruleset is a repository or organization ruleset. The bypass actors,
+// conditions and rules are kept as raw JSON so that they round trip through
+// export, create and update unchanged.
+type ruleset struct {
+	ID           int64           `json:"id,omitempty"`
+	Name         string          `json:"name"`
+	Target       string          `json:"target,omitempty"`
+	SourceType   string          `json:"source_type,omitempty"`
+	Source       string          `json:"source,omitempty"`
+	Enforcement  string          `json:"enforcement"`
+	BypassActors json.RawMessage `json:"bypass_actors,omitempty"`
+	Conditions   json.RawMessage `json:"conditions,omitempty"`
+	Rules        json.RawMessage `json:"rules,omitempty"`
+}
+
+// branchRule is a rule that applies to a branch, along with the ruleset it
+// comes from.
+type branchRule struct {
+	Type              string `json:"type"`
+	RulesetSourceType string `json:"ruleset_source_type"`
+	RulesetSource     string `json:"ruleset_source"`
+	RulesetID         int64  `json:"ruleset_id"`
+}
+
+func (cmd *rulesetsCommand) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("must pass an action: list, export, create, update or delete")
+	}
+	cmd.action, cmd.names = args[0], args[1:]
+
+	switch cmd.action {
+	case "list", "export":
+	case "create", "update":
+		if len(cmd.file) < 1 {
+			return fmt.Errorf("must pass a rulesets file with --file to %s", cmd.action)
+		}
+		b, err := ioutil.ReadFile(cmd.file)
+		if err != nil {
+			return fmt.Errorf("reading rulesets file %s failed: %v", cmd.file, err)
+		}
+		if err := json.Unmarshal(b, &cmd.rulesets); err != nil {
+			return fmt.Errorf("parsing rulesets file %s failed: %v", cmd.file, err)
+		}
+	case "delete":
+		if len(cmd.names) < 1 {
+			return errors.New("must pass the names of the rulesets to delete")
+		}
+	default:
+		return fmt.Errorf("unknown action %q, must be one of list, export, create, update or delete", cmd.action)
+	}
+
+	if err := runCommand(ctx, cmd.handleRulesets); err != nil {
+		return err
+	}
+
+	if cmd.action == "export" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cmd.exported)
+	}
+
+	return nil
+}
+
+// handleRulesets will return nil error if the user does not have access to something.
+func (cmd *rulesetsCommand) handleRulesets(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	// Only get the ones inherited from the organization when listing,
+	// everything else only acts on the repository rulesets.
+	existing, resp, err := listRulesets(ctx, client, repo, cmd.action == "list")
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch cmd.action {
+	case "list":
+		for _, rs := range existing {
+			fmt.Printf("%s: %s (%d) - target:%s enforcement:%s source:%s\n", repo.GetFullName(), rs.Name, rs.ID, rs.Target, rs.Enforcement, rs.Source)
+		}
+	case "export":
+		for _, rs := range existing {
+			// The list only returns a summary, get the whole ruleset.
+			full, _, err := getRuleset(ctx, client, repo, rs.ID)
+			if err != nil {
+				return err
+			}
+			cmd.exported = append(cmd.exported, *full)
+		}
+	case "create":
+		for _, want := range cmd.rulesets {
+			if findRuleset(existing, want.Name) != nil {
+				fmt.Printf("[OK] %s already has ruleset %s\n", repo.GetFullName(), want.Name)
+				continue
+			}
+
+			if dryrun {
+				fmt.Printf("[UPDATE] %s will have ruleset %s created\n", repo.GetFullName(), want.Name)
+				continue
+			}
+
+			if _, err := doRequest(ctx, client, "POST", fmt.Sprintf("repos/%s/%s/rulesets", repo.GetOwner().GetLogin(), repo.GetName()), rulesetRequest(want), nil); err != nil {
+				return err
+			}
+			fmt.Printf("[OK] %s has ruleset %s created\n", repo.GetFullName(), want.Name)
+		}
+	case "update":
+		for _, want := range cmd.rulesets {
+			rs := findRuleset(existing, want.Name)
+			if rs == nil {
+				fmt.Printf("[OK] %s does not have ruleset %s, skipping\n", repo.GetFullName(), want.Name)
+				continue
+			}
+
+			current, _, err := getRuleset(ctx, client, repo, rs.ID)
+			if err != nil {
+				return err
+			}
+
+			changes := diffRuleset(*current, want)
+			if len(changes) < 1 {
+				fmt.Printf("[OK] %s ruleset %s is up to date\n", repo.GetFullName(), want.Name)
+				continue
+			}
+
+			if dryrun {
+				fmt.Printf("[UPDATE] %s ruleset %s will be changed: %s\n", repo.GetFullName(), want.Name, strings.Join(changes, ", "))
+				continue
+			}
+
+			if _, err := doRequest(ctx, client, "PUT", fmt.Sprintf("repos/%s/%s/rulesets/%d", repo.GetOwner().GetLogin(), repo.GetName(), rs.ID), rulesetRequest(want), nil); err != nil {
+				return err
+			}
+			fmt.Printf("[OK] %s ruleset %s is updated: %s\n", repo.GetFullName(), want.Name, strings.Join(changes, ", "))
+		}
+	case "delete":
+		for _, name := range cmd.names {
+			rs := findRuleset(existing, name)
+			if rs == nil {
+				fmt.Printf("[OK] %s does not have ruleset %s\n", repo.GetFullName(), name)
+				continue
+			}
+
+			if dryrun {
+				fmt.Printf("[UPDATE] %s ruleset %s will be deleted\n", repo.GetFullName(), name)
+				continue
+			}
+
+			if _, err := doRequest(ctx, client, "DELETE", fmt.Sprintf("repos/%s/%s/rulesets/%d", repo.GetOwner().GetLogin(), repo.GetName(), rs.ID), nil, nil); err != nil {
+				return err
+			}
+			fmt.Printf("[OK] %s ruleset %s is deleted\n", repo.GetFullName(), name)
+		}
+	}
+
+	return nil
+}
+
+// listRulesets returns the rulesets for a repository. If includeParents is
+// true the rulesets inherited from the organization are included as well.
+func listRulesets(ctx context.Context, client *github.Client, repo *github.Repository, includeParents bool) ([]ruleset, *github.Response, error) {
+	all := []ruleset{}
+	for page := 1; ; {
+		u := fmt.Sprintf("repos/%s/%s/rulesets?includes_parents=%t&per_page=100&page=%d", repo.GetOwner().GetLogin(), repo.GetName(), includeParents, page)
+
+		var rulesets []ruleset
+		resp, err := doRequest(ctx, client, "GET", u, nil, &rulesets)
+		if err != nil {
+			return nil, resp, err
+		}
+		all = append(all, rulesets...)
+
+		// Return if we are on the last page.
+		if resp.NextPage == 0 {
+			return all, resp, nil
+		}
+		page = resp.NextPage
+	}
+}
+
+func getRuleset(ctx context.Context, client *github.Client, repo *github.Repository, id int64) (*ruleset, *github.Response, error) {
+	rs := new(ruleset)
+	resp, err := doRequest(ctx, client, "GET", fmt.Sprintf("repos/%s/%s/rulesets/%d", repo.GetOwner().GetLogin(), repo.GetName(), id), nil, rs)
+	if err != nil {
+		return nil, resp, err
+	}
+	return rs, resp, nil
+}
+
+// listBranchRules returns the rules from all the rulesets that apply to a
+// branch, following the pagination until the last page.
+func listBranchRules(ctx context.Context, client *github.Client, repo *github.Repository, branch string) ([]branchRule, *github.Response, error) {
+	// Escape the branch name but keep the slashes, e.g. 'release/v1.0'.
+	segments := strings.Split(branch, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+
+	all := []branchRule{}
+	for page := 1; ; {
+		u := fmt.Sprintf("repos/%s/%s/rules/branches/%s?per_page=100&page=%d", repo.GetOwner().GetLogin(), repo.GetName(), strings.Join(segments, "/"), page)
+
+		var rules []branchRule
+		resp, err := doRequest(ctx, client, "GET", u, nil, &rules)
+		if err != nil {
+			return nil, resp, err
+		}
+		all = append(all, rules...)
+
+		// Return if we are on the last page.
+		if resp.NextPage == 0 {
+			return all, resp, nil
+		}
+		page = resp.NextPage
+	}
+}
+
+// rulesetRequest strips the fields that are set by GitHub from a ruleset so
+// it can be used to create or update one.
+func rulesetRequest(rs ruleset) ruleset {
+	rs.ID = 0
+	rs.SourceType = ""
+	rs.Source = ""
+	return rs
+}
+
+func findRuleset(rulesets []ruleset, name string) *ruleset {
+	for i := range rulesets {
+		if rulesets[i].Name == name {
+			return &rulesets[i]
+		}
+	}
+	return nil
+}
+
+// diffRuleset returns the names of the settings that differ between the
+// existing and the wanted ruleset.
+func diffRuleset(current, want ruleset) []string {
+	changes := []string{}
+	if current.Target != want.Target && len(want.Target) > 0 {
+		changes = append(changes, fmt.Sprintf("target: %s -> %s", current.Target, want.Target))
+	}
+	if current.Enforcement != want.Enforcement {
+		changes = append(changes, fmt.Sprintf("enforcement: %s -> %s", current.Enforcement, want.Enforcement))
+	}
+	if !equalJSON(current.BypassActors, want.BypassActors) {
+		changes = append(changes, "bypass_actors")
+	}
+	if !equalJSON(current.Conditions, want.Conditions) {
+		changes = append(changes, "conditions")
+	}
+	if !equalJSON(current.Rules, want.Rules) {
+		changes = append(changes, "rules")
+	}
+	return changes
+}
+
+// equalJSON compares two raw JSON values ignoring formatting and key order.
+// An empty value is equal to null or an empty array.
+func equalJSON(a, b json.RawMessage) bool {
+	normalize := func(m json.RawMessage) []byte {
+		var v interface{}
+		if len(m) > 0 {
+			if err := json.Unmarshal(m, &v); err != nil {
+				return m
+			}
+		}
+		if a, ok := v.([]interface{}); ok && len(a) < 1 {
+			v = nil
+		}
+		b, _ := json.Marshal(v)
+		return b
+	}
+	return bytes.Equal(normalize(a), normalize(b))
+}
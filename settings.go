@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/google/go-github/github"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const settingsHelp = `Update the repository settings.`
+
+const settingsLongHelp = `Update the repository settings.
+
+The settings can be passed as flags or in a YAML file with --file, flags take
+precedence over the file. Settings that are not passed are left untouched.
+
+Example file:
+
+  has_issues: true
+  has_wiki: false
+  has_projects: false
+  homepage: https://github.com/genuinetools
+  visibility: public
+  web_commit_signoff_required: true`
+
+func (cmd *settingsCommand) Name() string      { return "settings" }
+func (cmd *settingsCommand) Args() string      { return "[OPTIONS]" }
+func (cmd *settingsCommand) ShortHelp() string { return settingsHelp }
+func (cmd *settingsCommand) LongHelp() string  { return settingsLongHelp }
+func (cmd *settingsCommand) Hidden() bool      { return false }
+
+func (cmd *settingsCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.file, "file", "", "YAML file containing the settings")
+	fs.StringVar(&cmd.file, "f", "", "YAML file containing the settings")
+
+	fs.Var(&cmd.hasIssues, "has-issues", "Enable issues")
+	fs.Var(&cmd.hasWiki, "has-wiki", "Enable the wiki")
+	fs.Var(&cmd.hasProjects, "has-projects", "Enable projects")
+	fs.Var(&cmd.description, "description", "Description of the repository, an empty value clears it")
+	fs.Var(&cmd.homepage, "homepage", "URL with more information about the repository, an empty value clears it")
+	fs.StringVar(&cmd.defaultBranch, "default-branch", "", "Default branch of the repository, the branch must exist")
+	fs.StringVar(&cmd.visibility, "visibility", "", "Visibility of the repository (public, private or internal)")
+	fs.Var(&cmd.isTemplate, "is-template", "Make the repository available as a template")
+	fs.Var(&cmd.webCommitSignoff, "web-commit-signoff", "Require contributors to sign off on web-based commits")
+}
+
+type settingsCommand struct {
+	file string
+
+	hasIssues        optionalBool
+	hasWiki          optionalBool
+	hasProjects      optionalBool
+	description      optionalStringFlag
+	homepage         optionalStringFlag
+	defaultBranch    string
+	visibility       string
+	isTemplate       optionalBool
+	webCommitSignoff optionalBool
+
+	want repoSettings
+}
+
+// repoSettings are the general settings of a repository. Settings that are nil
+// are left untouched. Not all of them are supported by the GitHub client yet,
+// so they are read and edited with their own requests.
+type repoSettings struct {
+	HasIssues                *bool   `json:"has_issues,omitempty" yaml:"has_issues"`
+	HasWiki                  *bool   `json:"has_wiki,omitempty" yaml:"has_wiki"`
+	HasProjects              *bool   `json:"has_projects,omitempty" yaml:"has_projects"`
+	Description              *string `json:"description,omitempty" yaml:"description"`
+	Homepage                 *string `json:"homepage,omitempty" yaml:"homepage"`
+	DefaultBranch            *string `json:"default_branch,omitempty" yaml:"default_branch"`
+	Visibility               *string `json:"visibility,omitempty" yaml:"visibility"`
+	IsTemplate               *bool   `json:"is_template,omitempty" yaml:"is_template"`
+	WebCommitSignoffRequired *bool   `json:"web_commit_signoff_required,omitempty" yaml:"web_commit_signoff_required"`
+}
+
+func (cmd *settingsCommand) Run(ctx context.Context, args []string) error {
+	if len(cmd.file) > 0 {
+		b, err := ioutil.ReadFile(cmd.file)
+		if err != nil {
+			return fmt.Errorf("reading settings file %s failed: %v", cmd.file, err)
+		}
+		if err := yaml.UnmarshalStrict(b, &cmd.want); err != nil {
+			return fmt.Errorf("parsing settings file %s failed: %v", cmd.file, err)
+		}
+	}
+
+	// The flags take precedence over the file.
+	for _, v := range []struct {
+		field **bool
+		value *bool
+	}{
+		{&cmd.want.HasIssues, cmd.hasIssues.value},
+		{&cmd.want.HasWiki, cmd.hasWiki.value},
+		{&cmd.want.HasProjects, cmd.hasProjects.value},
+		{&cmd.want.IsTemplate, cmd.isTemplate.value},
+		{&cmd.want.WebCommitSignoffRequired, cmd.webCommitSignoff.value},
+	} {
+		if v.value != nil {
+			*v.field = v.value
+		}
+	}
+	for _, v := range []struct {
+		field **string
+		value *string
+	}{
+		{&cmd.want.Description, cmd.description.value},
+		{&cmd.want.Homepage, cmd.homepage.value},
+		{&cmd.want.DefaultBranch, optionalString(cmd.defaultBranch)},
+		{&cmd.want.Visibility, optionalString(cmd.visibility)},
+	} {
+		if v.value != nil {
+			*v.field = v.value
+		}
+	}
+
+	if cmd.want.Visibility != nil && !in([]string{"public", "private", "internal"}, *cmd.want.Visibility) {
+		return errors.New("visibility must be one of public, private or internal")
+	}
+
+	if reflect.DeepEqual(cmd.want, repoSettings{}) {
+		return errors.New("you must pass at least one setting as a flag or in a file")
+	}
+
+	return runCommand(ctx, cmd.handleRepoSettings)
+}
+
+// handleRepoSettings will return nil error if the user does not have access to something.
+func (cmd *settingsCommand) handleRepoSettings(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	var current repoSettings
+	resp, err := getSettings(ctx, client, repo, &current)
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+		return nil
+	}
+	if err != nil {
+		if _, ok := err.(*github.RateLimitError); ok {
+			return err
+		}
+		return fmt.Errorf("getting settings for %s failed: %v", repo.GetFullName(), err)
+	}
+
+	changes := diffSettings(current, cmd.want)
+
+	if dryrun && len(changes) > 0 {
+		fmt.Printf("[UPDATE] %s settings will be changed\n", repo.GetFullName())
+		printSettingChanges(changes)
+		return nil
+	}
+
+	if len(changes) < 1 {
+		fmt.Printf("[OK] %s settings are already set\n", repo.GetFullName())
+		return nil
+	}
+
+	// Edit the repo settings, only sending the ones that changed.
+	var edit repoSettings
+	setChangedSettings(&edit, cmd.want, changes)
+	resp, err = editSettings(ctx, client, repo, edit)
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+		return nil
+	}
+	if err != nil {
+		if _, ok := err.(*github.RateLimitError); ok {
+			return err
+		}
+		return fmt.Errorf("editing settings for %s failed: %v", repo.GetFullName(), err)
+	}
+	fmt.Printf("[OK] %s settings are set\n", repo.GetFullName())
+	printSettingChanges(changes)
+
+	return nil
+}
+
+// getSettings decodes the repository into v, which is a pointer to one of
+// the settings structs.
+func getSettings(ctx context.Context, client *github.Client, repo *github.Repository, v interface{}) (*github.Response, error) {
+	return doRequest(ctx, client, "GET", fmt.Sprintf("repos/%s/%s", repo.GetOwner().GetLogin(), repo.GetName()), nil, v)
+}
+
+// editSettings edits the repository with the settings in v that are not nil.
+func editSettings(ctx context.Context, client *github.Client, repo *github.Repository, v interface{}) (*github.Response, error) {
+	return doRequest(ctx, client, "PATCH", fmt.Sprintf("repos/%s/%s", repo.GetOwner().GetLogin(), repo.GetName()), v, nil)
+}
+
+// settingChange is a single setting that differs between the existing and the
+// wanted settings.
+type settingChange struct {
+	field string
+	from  string
+	to    string
+}
+
+func (c settingChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.field, c.from, c.to)
+}
+
+func printSettingChanges(changes []settingChange) {
+	for _, c := range changes {
+		fmt.Printf("\t%s\n", c)
+	}
+}
+
+// diffSettings compares two structs of the same type with pointer fields and
+// returns the fields that are set in want and differ from current. The field
+// names are taken from the json tags.
+func diffSettings(current, want interface{}) []settingChange {
+	cv, wv := reflect.ValueOf(current), reflect.ValueOf(want)
+
+	changes := []settingChange{}
+	for i := 0; i < wv.NumField(); i++ {
+		w := wv.Field(i)
+		if w.IsNil() {
+			continue
+		}
+
+		to, from := settingValue(w), settingValue(cv.Field(i))
+
+		if from != to {
+			changes = append(changes, settingChange{
+				field: strings.SplitN(wv.Type().Field(i).Tag.Get("json"), ",", 2)[0],
+				from:  from,
+				to:    to,
+			})
+		}
+	}
+
+	return changes
+}
+
+// settingValue returns the value of a setting as a string. GitHub returns null
+// for cleared strings, so empty strings are the same as no value.
+func settingValue(v reflect.Value) string {
+	if v.IsNil() {
+		return "<none>"
+	}
+	s := fmt.Sprint(v.Elem().Interface())
+	if len(s) < 1 {
+		return "<none>"
+	}
+	return s
+}
+
+// setChangedSettings copies the fields of want that are in the changes into
+// edit, which must be a pointer to a struct of the same type.
+func setChangedSettings(edit interface{}, want interface{}, changes []settingChange) {
+	ev, wv := reflect.ValueOf(edit).Elem(), reflect.ValueOf(want)
+
+	for i := 0; i < wv.NumField(); i++ {
+		field := strings.SplitN(wv.Type().Field(i).Tag.Get("json"), ",", 2)[0]
+		for _, c := range changes {
+			if c.field == field {
+				ev.Field(i).Set(wv.Field(i))
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	// tagRulesetName is the name of the tag ruleset managed by protect --tags.
+	// GitHub replaced the tag protection rules by tag rulesets.
+	tagRulesetName = "pepper protected tags"
+
+	// tagRulesetRules prevent users from creating, moving or deleting the
+	// protected tags, the same as the tag protection rules did.
+	tagRulesetRules = `[{"type":"creation"},{"type":"update"},{"type":"deletion"}]`
+
+	// tagRulesetBypassActors lets the repository admins manage the protected
+	// tags.
+	tagRulesetBypassActors = `[{"actor_id":5,"actor_type":"RepositoryRole","bypass_mode":"always"}]`
+)
+
+// refNameConditions are the conditions of a ruleset on the ref names.
+type refNameConditions struct {
+	RefName struct {
+		Include []string `json:"include"`
+		Exclude []string `json:"exclude"`
+	} `json:"ref_name"`
+}
+
+// handleRepoProtectTags reconciles the patterns of the tag ruleset of a
+// repository with the patterns passed on the command line. Patterns that are
+// not in the list are removed. If --remove was passed only the patterns passed
+// are removed.
+//
+// It will return nil error if the user does not have access to something.
+func (cmd *protectCommand) handleRepoProtectTags(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	existing, resp, err := listRulesets(ctx, client, repo, false)
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+		fmt.Printf("[WARN] %s rulesets are not available, tags can not be protected: %v\n", repo.GetFullName(), err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var current *ruleset
+	patterns := []string{}
+	if rs := findRuleset(existing, tagRulesetName); rs != nil {
+		current, _, err = getRuleset(ctx, client, repo, rs.ID)
+		if err != nil {
+			return err
+		}
+		patterns, err = tagPatterns(*current)
+		if err != nil {
+			return fmt.Errorf("parsing the conditions of ruleset %s in %s failed: %v", tagRulesetName, repo.GetFullName(), err)
+		}
+	}
+
+	want := []string{}
+	changed := false
+	for _, pattern := range patterns {
+		// Remove the patterns that should not be protected.
+		if in(cmd.tags, pattern) != cmd.remove {
+			want = append(want, pattern)
+			continue
+		}
+
+		changed = true
+		if dryrun {
+			fmt.Printf("[UPDATE] %s tag protection %s will be removed\n", repo.GetFullName(), pattern)
+		}
+	}
+
+	if !cmd.remove {
+		// Add the patterns that are missing.
+		for _, pattern := range cmd.tags {
+			if in(patterns, pattern) {
+				fmt.Printf("[OK] %s tags matching %s are already protected\n", repo.GetFullName(), pattern)
+				continue
+			}
+
+			want = append(want, pattern)
+			changed = true
+			if dryrun {
+				fmt.Printf("[UPDATE] %s tags matching %s will be changed to protected\n", repo.GetFullName(), pattern)
+			}
+		}
+	}
+
+	if !changed || dryrun {
+		return nil
+	}
+
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+	switch {
+	case len(want) < 1:
+		if _, err := doRequest(ctx, client, "DELETE", fmt.Sprintf("repos/%s/%s/rulesets/%d", owner, name, current.ID), nil, nil); err != nil {
+			return err
+		}
+	case current == nil:
+		rs, err := tagRuleset(want)
+		if err != nil {
+			return err
+		}
+		if _, err := doRequest(ctx, client, "POST", fmt.Sprintf("repos/%s/%s/rulesets", owner, name), rs, nil); err != nil {
+			return err
+		}
+	default:
+		conditions, err := tagConditions(want)
+		if err != nil {
+			return err
+		}
+		rs := rulesetRequest(*current)
+		rs.Conditions = conditions
+		if _, err := doRequest(ctx, client, "PUT", fmt.Sprintf("repos/%s/%s/rulesets/%d", owner, name, current.ID), rs, nil); err != nil {
+			return err
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !in(want, pattern) {
+			fmt.Printf("[OK] %s tag protection %s removed\n", repo.GetFullName(), pattern)
+		}
+	}
+	for _, pattern := range want {
+		if !in(patterns, pattern) {
+			fmt.Printf("[OK] %s tags matching %s are protected\n", repo.GetFullName(), pattern)
+		}
+	}
+
+	return nil
+}
+
+// listProtectedTags returns the patterns of the tags protected by the active
+// tag rulesets of the repository.
+func listProtectedTags(ctx context.Context, client *github.Client, repo *github.Repository, rulesets []ruleset) ([]string, error) {
+	patterns := []string{}
+	for _, rs := range rulesets {
+		if rs.Target != "tag" || rs.Enforcement != "active" {
+			continue
+		}
+
+		// The list only returns a summary, get the whole ruleset.
+		full, _, err := getRuleset(ctx, client, repo, rs.ID)
+		if err != nil {
+			return nil, err
+		}
+		p, err := tagPatterns(*full)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p...)
+	}
+	return patterns, nil
+}
+
+// tagRuleset returns the ruleset protecting the tags matching the patterns.
+func tagRuleset(patterns []string) (ruleset, error) {
+	conditions, err := tagConditions(patterns)
+	if err != nil {
+		return ruleset{}, err
+	}
+	return ruleset{
+		Name:         tagRulesetName,
+		Target:       "tag",
+		Enforcement:  "active",
+		BypassActors: json.RawMessage(tagRulesetBypassActors),
+		Conditions:   conditions,
+		Rules:        json.RawMessage(tagRulesetRules),
+	}, nil
+}
+
+// tagConditions returns the ruleset conditions matching the tag patterns.
+func tagConditions(patterns []string) (json.RawMessage, error) {
+	var c refNameConditions
+	c.RefName.Include = []string{}
+	c.RefName.Exclude = []string{}
+	for _, p := range patterns {
+		c.RefName.Include = append(c.RefName.Include, "refs/tags/"+p)
+	}
+	return json.Marshal(c)
+}
+
+// tagPatterns returns the tag patterns the ruleset includes.
+func tagPatterns(rs ruleset) ([]string, error) {
+	patterns := []string{}
+	if len(rs.Conditions) < 1 {
+		return patterns, nil
+	}
+
+	var c refNameConditions
+	if err := json.Unmarshal(rs.Conditions, &c); err != nil {
+		return nil, err
+	}
+	for _, p := range c.RefName.Include {
+		patterns = append(patterns, strings.TrimPrefix(p, "refs/tags/"))
+	}
+	return patterns, nil
+}
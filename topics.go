@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const topicsHelp = `List, add, remove and set the topics of the repositories.`
+
+const topicsLongHelp = `List, add, remove and set the topics of the repositories.
+
+Actions:
+
+  list                  list the topics for the repositories
+  add TOPIC...          add the topics to the repositories
+  remove TOPIC...       remove the topics from the repositories
+  set TOPIC...          replace the topics of the repositories
+  apply -f FILE         add the topics derived from the rules in the YAML file
+
+Each rule in the file matches repositories by a glob of their name (or full
+name if the pattern contains a '/') and/or their language:
+
+  - name: "docker-*"
+    topics: [docker]
+  - language: Go
+    topics: [golang]`
+
+func (cmd *topicsCommand) Name() string      { return "topics" }
+func (cmd *topicsCommand) Args() string      { return "[OPTIONS] ACTION [TOPIC...]" }
+func (cmd *topicsCommand) ShortHelp() string { return topicsHelp }
+func (cmd *topicsCommand) LongHelp() string  { return topicsLongHelp }
+func (cmd *topicsCommand) Hidden() bool      { return false }
+
+func (cmd *topicsCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.file, "file", "", "YAML file containing the rules to apply")
+	fs.StringVar(&cmd.file, "f", "", "YAML file containing the rules to apply")
+}
+
+type topicsCommand struct {
+	file string
+
+	action string
+	topics []string
+	rules  []topicRule
+}
+
+// topicRule derives topics for the repositories that match the name pattern
+// and language. Empty fields match every repository.
+type topicRule struct {
+	Name     string   `yaml:"name"`
+	Language string   `yaml:"language"`
+	Topics   []string `yaml:"topics"`
+}
+
+func (cmd *topicsCommand) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("must pass an action: list, add, remove, set or apply")
+	}
+	cmd.action = args[0]
+	for _, t := range args[1:] {
+		cmd.topics = append(cmd.topics, strings.ToLower(t))
+	}
+
+	switch cmd.action {
+	case "list", "set":
+	case "add", "remove":
+		if len(cmd.topics) < 1 {
+			return fmt.Errorf("must pass the topics to %s", cmd.action)
+		}
+	case "apply":
+		if len(cmd.file) < 1 {
+			return errors.New("must pass a rules file with --file to apply")
+		}
+		b, err := ioutil.ReadFile(cmd.file)
+		if err != nil {
+			return fmt.Errorf("reading rules file %s failed: %v", cmd.file, err)
+		}
+		if err := yaml.UnmarshalStrict(b, &cmd.rules); err != nil {
+			return fmt.Errorf("parsing rules file %s failed: %v", cmd.file, err)
+		}
+		for _, r := range cmd.rules {
+			if _, err := path.Match(r.Name, ""); err != nil {
+				return fmt.Errorf("invalid name pattern %q: %v", r.Name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown action %q, must be one of list, add, remove, set or apply", cmd.action)
+	}
+
+	return runCommand(ctx, cmd.handleRepoTopics)
+}
+
+// handleRepoTopics will return nil error if the user does not have access to something.
+func (cmd *topicsCommand) handleRepoTopics(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	current, resp, err := client.Repositories.ListAllTopics(ctx, repo.GetOwner().GetLogin(), repo.GetName())
+	if resp == nil || resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden || err != nil {
+		if _, ok := err.(*github.RateLimitError); ok {
+			return err
+		}
+
+		return nil
+	}
+
+	if cmd.action == "list" {
+		fmt.Printf("%s: %s\n", repo.GetFullName(), strings.Join(current, ", "))
+		return nil
+	}
+
+	want := []string{}
+	switch cmd.action {
+	case "add":
+		want = append(want, current...)
+		want = append(want, cmd.topics...)
+	case "remove":
+		for _, t := range current {
+			if !in(cmd.topics, t) {
+				want = append(want, t)
+			}
+		}
+	case "set":
+		want = append(want, cmd.topics...)
+	case "apply":
+		want = append(want, current...)
+		for _, r := range cmd.rules {
+			if r.match(repo) {
+				want = append(want, r.Topics...)
+			}
+		}
+	}
+	want = uniqueTopics(want)
+
+	added, removed := diffTopics(current, want)
+	if len(added) < 1 && len(removed) < 1 {
+		fmt.Printf("[OK] %s topics are already set to %s\n", repo.GetFullName(), strings.Join(want, ", "))
+		return nil
+	}
+
+	diff := []string{}
+	for _, t := range added {
+		diff = append(diff, "+"+t)
+	}
+	for _, t := range removed {
+		diff = append(diff, "-"+t)
+	}
+
+	if dryrun {
+		fmt.Printf("[UPDATE] %s topics will be changed: %s\n", repo.GetFullName(), strings.Join(diff, " "))
+		return nil
+	}
+
+	if _, _, err := client.Repositories.ReplaceAllTopics(ctx, repo.GetOwner().GetLogin(), repo.GetName(), want); err != nil {
+		return err
+	}
+	fmt.Printf("[OK] %s topics are changed: %s\n", repo.GetFullName(), strings.Join(diff, " "))
+
+	return nil
+}
+
+// match returns true if the repository matches the name pattern and the
+// language of the rule.
+func (r topicRule) match(repo *github.Repository) bool {
+	if len(r.Name) > 0 {
+		name := repo.GetName()
+		if strings.Contains(r.Name, "/") {
+			name = repo.GetFullName()
+		}
+		if ok, _ := path.Match(r.Name, name); !ok {
+			return false
+		}
+	}
+
+	if len(r.Language) > 0 && !strings.EqualFold(r.Language, repo.GetLanguage()) {
+		return false
+	}
+
+	return true
+}
+
+// uniqueTopics returns the sorted topics in lowercase without duplicates.
+func uniqueTopics(topics []string) []string {
+	seen := map[string]bool{}
+	u := []string{}
+	for _, t := range topics {
+		t = strings.ToLower(t)
+		if !seen[t] {
+			seen[t] = true
+			u = append(u, t)
+		}
+	}
+	sort.Strings(u)
+	return u
+}
+
+// diffTopics returns the topics that are in want but not in current and the
+// ones that are in current but not in want.
+func diffTopics(current, want []string) (added, removed []string) {
+	for _, t := range want {
+		if !in(current, t) {
+			added = append(added, t)
+		}
+	}
+	for _, t := range current {
+		if !in(want, t) {
+			removed = append(removed, t)
+		}
+	}
+	return added, removed
+}